@@ -57,7 +57,7 @@ func runClone(cmd *cobra.Command, args []string) {
 	}
 	log.Log("Checking out revision '%s'\n", revision)
 	mod.Checkout(revision)
-	module.SetupModule(repoPath)
+	module.SetupModule(repoPath, module.ReadSetupPolicy(repoPath), false)
 
 	// Move into the repo directory in order to set it up
 	os.Chdir(repoPath)
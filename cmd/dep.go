@@ -12,7 +12,7 @@ import (
 
 var (
 	nameRegexp    = regexp.MustCompile(`^[a-z0-9_\-.]+$`)
-	urlRegexp     = regexp.MustCompile(`/([A-Za-z0-9_\-.]+)(\.git|\.tar\.gz)$`)
+	urlRegexp     = regexp.MustCompile(`/([A-Za-z0-9_\-.]+?)(\.git|\.tar\.gz|\.tgz|\.tar\.xz|\.txz|\.tar\.zst|\.tar\.bz2|\.tbz2|\.zip|\.tar)$`)
 	versionRegexp = regexp.MustCompile(`^[A-Za-z0-9_\-./]+$`)
 )
 
@@ -25,7 +25,7 @@ var (
 	}
 
 	addCmd = &cobra.Command{
-		Use:               "add [NAME] --url=URL [--version=VERSION]",
+		Use:               "add [NAME] --url=URL [--version=VERSION] [--subdir=DIR]",
 		Args:              cobra.RangeArgs(0, 1),
 		Short:             "Adds a dependency to the MODULE file of the current module",
 		Long:              `Adds a dependency to the MODULE file of the current module.`,
@@ -43,7 +43,7 @@ var (
 	}
 )
 
-var url, version string
+var url, version, subdir string
 
 func init() {
 	rootCmd.AddCommand(depCmd)
@@ -51,6 +51,7 @@ func init() {
 	depCmd.AddCommand(addCmd)
 	addCmd.Flags().StringVar(&url, "url", "", "Dependency URL")
 	addCmd.Flags().StringVar(&version, "version", masterVersion, "Dependency version")
+	addCmd.Flags().StringVar(&subdir, "subdir", "", "Subdirectory of the repository that contains the module")
 
 	depCmd.AddCommand(removeCmd)
 }
@@ -63,7 +64,9 @@ func runAdd(cmd *cobra.Command, args []string) {
 	moduleFile := module.ReadModuleFile(moduleRoot)
 
 	var name string
-	if len(args) == 0 {
+	if len(args) == 0 && subdir != "" {
+		name = path.Base(subdir)
+	} else if len(args) == 0 {
 		checkUrl(url)
 		name = urlRegexp.FindStringSubmatch(url)[1]
 	} else {
@@ -78,6 +81,9 @@ func runAdd(cmd *cobra.Command, args []string) {
 	if version != "" {
 		dep.Version = version
 	}
+	if subdir != "" {
+		dep.Subdir = subdir
+	}
 
 	checkUrl(dep.URL)
 	checkVersion(dep.Version)
@@ -126,6 +132,12 @@ func checkUrl(url string) {
 }
 
 func checkVersion(version string) {
+	if util.IsVersionConstraint(version) {
+		if _, err := util.ParseVersionConstraint(version); err != nil {
+			log.Fatal("Version '%s' is not a valid version constraint: %s.\n", version, err)
+		}
+		return
+	}
 	if !versionRegexp.MatchString(version) {
 		log.Fatal("Version '%s' does not match the expected format.\n", version)
 	}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Args:  cobra.NoArgs,
+	Short: "Prints the dependency graph of all modules in the workspace",
+	Long: `Prints the dependency graph of all modules in the workspace as declared in their MODULE files.
+Each edge carries the version and hash that the dependency requires. Edges that require a different hash
+than the one that is checked out and edges that are part of a dependency cycle are highlighted.`,
+	Run: runGraph,
+}
+
+var graphFormat string
+
+func init() {
+	graphCmd.Flags().StringVar(&graphFormat, "format", "dot", "Output format (dot, json or mermaid).")
+	depCmd.AddCommand(graphCmd)
+}
+
+type graphNode struct {
+	Name string
+	Type string `json:",omitempty"`
+	// Head is the checked out hash of a dependency, or empty if the dependency is not in the workspace.
+	Head string `json:",omitempty"`
+}
+
+type graphEdge struct {
+	From     string
+	To       string
+	Version  string
+	Hash     string
+	Conflict bool
+	Cycle    bool
+}
+
+type moduleGraph struct {
+	Root  string
+	Nodes []graphNode
+	Edges []graphEdge
+}
+
+func runGraph(cmd *cobra.Command, args []string) {
+	var printGraph func(moduleGraph)
+	switch graphFormat {
+	case "dot":
+		printGraph = printDotGraph
+	case "json":
+		printGraph = printJsonGraph
+	case "mermaid":
+		printGraph = printMermaidGraph
+	default:
+		log.Fatal("Unknown graph format '%s'. Use 'dot', 'json' or 'mermaid'.\n", graphFormat)
+	}
+
+	printGraph(buildDependencyGraph(module.ReadDependencyGraph(util.GetWorkspaceRoot())))
+}
+
+func buildDependencyGraph(graph module.DependencyGraph) moduleGraph {
+	result := moduleGraph{Root: graph.Root}
+
+	names := map[string]bool{graph.Root: true}
+	for _, edge := range graph.Edges {
+		names[edge.From] = true
+		names[edge.To] = true
+	}
+	heads := map[string]string{}
+	for _, name := range util.OrderedKeys(names) {
+		node := graphNode{Name: name}
+		// The workspace module is not pinned, so its hash is irrelevant.
+		if mod, exists := graph.Modules.Lookup(name); exists && name != graph.Root {
+			node.Type = mod.Type().String()
+			node.Head = mod.Head()
+			heads[name] = node.Head
+		}
+		result.Nodes = append(result.Nodes, node)
+	}
+
+	for _, edge := range graph.Edges {
+		result.Edges = append(result.Edges, graphEdge{
+			From:     edge.From,
+			To:       edge.To,
+			Version:  edge.Version,
+			Hash:     edge.Hash,
+			Conflict: isConflictingEdge(graph, edge, heads[edge.To]),
+			Cycle:    graph.IsCycle(edge),
+		})
+	}
+	return result
+}
+
+// isConflictingEdge reports whether the edge requires a different hash than the one that is checked out.
+// Version ranges only conflict if the checked out hash is not tagged with a version in the range.
+func isConflictingEdge(graph module.DependencyGraph, edge module.DependencyEdge, head string) bool {
+	if edge.Hash == "" || head == "" || edge.Hash == head {
+		return false
+	}
+	if util.IsVersionConstraint(edge.Version) {
+		mod, _ := graph.Modules.Lookup(edge.To)
+		_, ok := matchingTagForHash(mod, head, edge.Version)
+		return !ok
+	}
+	return true
+}
+
+func printJsonGraph(graph moduleGraph) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(graph); err != nil {
+		log.Fatal("Failed to encode dependency graph: %s.\n", err)
+	}
+}
+
+func edgeLabel(edge graphEdge) string {
+	if edge.Hash == "" {
+		return edge.Version
+	}
+	return fmt.Sprintf("%s\\n%s", edge.Version, shortHash(edge.Hash))
+}
+
+func printDotGraph(graph moduleGraph) {
+	fmt.Println("digraph dependencies {")
+	for _, node := range graph.Nodes {
+		attributes := []string{fmt.Sprintf("label=%q", node.Name)}
+		if node.Name == graph.Root {
+			attributes = append(attributes, "shape=box")
+		}
+		if node.Head == "" && node.Name != graph.Root {
+			attributes = append(attributes, "style=dashed")
+		}
+		fmt.Printf("  %q [%s];\n", node.Name, strings.Join(attributes, ", "))
+	}
+	for _, edge := range graph.Edges {
+		attributes := []string{fmt.Sprintf("label=\"%s\"", strings.ReplaceAll(edgeLabel(edge), "\"", "\\\""))}
+		if edge.Conflict {
+			attributes = append(attributes, "color=red", "fontcolor=red")
+		}
+		if edge.Cycle {
+			attributes = append(attributes, "style=bold", "penwidth=2")
+			if !edge.Conflict {
+				attributes = append(attributes, "color=orange")
+			}
+		}
+		fmt.Printf("  %q -> %q [%s];\n", edge.From, edge.To, strings.Join(attributes, ", "))
+	}
+	fmt.Println("}")
+}
+
+func printMermaidGraph(graph moduleGraph) {
+	// Module names may contain characters that are not valid in Mermaid node ids.
+	ids := map[string]string{}
+	fmt.Println("graph TD")
+	for idx, node := range graph.Nodes {
+		ids[node.Name] = fmt.Sprintf("m%d", idx)
+		if node.Name == graph.Root {
+			fmt.Printf("  %s[\"%s\"]\n", ids[node.Name], node.Name)
+		} else {
+			fmt.Printf("  %s(\"%s\")\n", ids[node.Name], node.Name)
+		}
+	}
+	for _, edge := range graph.Edges {
+		label := strings.ReplaceAll(edgeLabel(edge), "\\n", " ")
+		fmt.Printf("  %s -->|\"%s\"| %s\n", ids[edge.From], strings.ReplaceAll(label, "\"", "#quot;"), ids[edge.To])
+	}
+	for idx, edge := range graph.Edges {
+		if edge.Conflict {
+			fmt.Printf("  linkStyle %d stroke:red,color:red\n", idx)
+		} else if edge.Cycle {
+			fmt.Printf("  linkStyle %d stroke:orange,stroke-width:3px\n", idx)
+		}
+	}
+}
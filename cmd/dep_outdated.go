@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated",
+	Args:  cobra.NoArgs,
+	Short: "Lists dependencies whose pinned hash is behind their version",
+	Long: `Fetches all modules in the workspace and compares the hash that each dependency in the MODULE
+files is pinned to with the hash that its version currently resolves to.`,
+	Run: runOutdated,
+}
+
+func init() {
+	depCmd.AddCommand(outdatedCmd)
+}
+
+// commitLister is implemented by modules backed by a git repository.
+type commitLister interface {
+	GetCommitsBetweenRefs(base, head string) ([]string, error)
+}
+
+func runOutdated(cmd *cobra.Command, args []string) {
+	workspaceRoot := util.GetWorkspaceRoot()
+	graph := module.ReadDependencyGraph(workspaceRoot)
+	replacements := module.ReadReplacements(workspaceRoot)
+
+	// The content at the URL of archives only needs to be hashed once.
+	fetched := map[string]bool{}
+	remoteHashes := map[string]string{}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "MODULE\tREQUIRED BY\tVERSION\tPINNED\tLATEST\tBEHIND\tNEWEST TAG")
+	outdated := 0
+	for _, edge := range graph.Edges {
+		latest, behind, newestTag := "", "", ""
+		mod, exists := graph.Modules.Lookup(edge.To)
+		if _, isReplaced := replacements[edge.To]; isReplaced {
+			behind = "replaced"
+		} else if !exists {
+			behind = "not synced"
+		} else if tarMod, isTar := mod.(module.TarModule); isTar {
+			if _, hasBeenFetched := remoteHashes[edge.To]; !hasBeenFetched {
+				log.Log("Downloading %s\n", edge.To)
+				remoteHash, err := tarMod.RemoteHash()
+				if err != nil {
+					log.Warning("Failed to download '%s': %s.\n", edge.To, err)
+				}
+				remoteHashes[edge.To] = remoteHash
+			}
+			latest = remoteHashes[edge.To]
+			if latest == "" {
+				behind = "unknown"
+			} else if latest != edge.Hash {
+				behind = "changed"
+			}
+		} else {
+			if !fetched[edge.To] {
+				log.Log("Fetching %s\n", edge.To)
+				mod.Fetch()
+				fetched[edge.To] = true
+			}
+			latest, newestTag = latestVersion(mod, edge.Version)
+			behind = commitsBehind(mod, edge.Hash, latest)
+		}
+
+		if behind != "" {
+			outdated++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", edge.To, edge.From, edge.Version, shortHash(edge.Hash), shortHash(latest), behind, newestTag)
+	}
+
+	writer.Flush()
+
+	if outdated == 0 {
+		log.Success("All dependencies are up to date.\n")
+	} else {
+		log.Warning("%d of %d dependencies are not up to date.\n", outdated, len(graph.Edges))
+	}
+}
+
+// latestVersion returns the hash that `version` currently resolves to, and the newest semantic
+// version tag of the module. Version ranges resolve to their highest matching tag.
+func latestVersion(mod module.Module, version string) (string, string) {
+	tags := mod.Tags()
+	newestTag, _ := util.HighestMatchingVersion(util.OrderedKeys(tags))
+
+	if !util.IsVersionConstraint(version) {
+		return mod.RevParse(version), newestTag
+	}
+
+	constraint := parseVersionConstraint(version)
+	if newestVersion, _ := util.ParseSemVer(newestTag); newestTag != "" && !constraint.Matches(newestVersion) {
+		newestTag = fmt.Sprintf("%s (outside of '%s')", newestTag, version)
+	}
+	tag, ok := util.HighestMatchingVersion(util.OrderedKeys(tags), constraint)
+	if !ok {
+		return "", newestTag
+	}
+	return tags[tag], newestTag
+}
+
+// commitsBehind describes how many commits the pinned hash is behind the latest hash.
+func commitsBehind(mod module.Module, pinned, latest string) string {
+	if latest == "" {
+		return "no match"
+	}
+	if pinned == "" {
+		return "not pinned"
+	}
+	if pinned == latest {
+		return ""
+	}
+
+	lister, ok := mod.(commitLister)
+	if !ok {
+		return "changed"
+	}
+	commits, err := lister.GetCommitsBetweenRefs(pinned, latest)
+	if err != nil {
+		return "unknown"
+	}
+	if len(commits) == 0 {
+		// The pinned hash is ahead of the version.
+		return ""
+	}
+	return fmt.Sprintf("%d commits", len(commits))
+}
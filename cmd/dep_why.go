@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// maxPrintedPaths is the number of dependency paths after which 'dbt dep why' only prints how many
+// paths it has left out.
+const maxPrintedPaths = 20
+
+var whyCmd = &cobra.Command{
+	Use:               "why MODULE",
+	Args:              cobra.ExactArgs(1),
+	Short:             "Explains why a module is part of the workspace",
+	Long:              `Prints every dependency path from the workspace module to MODULE, with the version and hash that each dependency requires. At most 20 paths are printed.`,
+	Run:               runWhy,
+	ValidArgsFunction: completeWorkspaceModules,
+}
+
+func init() {
+	depCmd.AddCommand(whyCmd)
+}
+
+func runWhy(cmd *cobra.Command, args []string) {
+	workspaceRoot := util.GetWorkspaceRoot()
+	name := args[0]
+
+	graph := module.ReadDependencyGraph(workspaceRoot)
+	if name == graph.Root {
+		log.Log("'%s' is the workspace module.\n", name)
+		return
+	}
+
+	paths, count := graph.Paths(name, maxPrintedPaths)
+	if count == 0 {
+		if _, exists := graph.Modules.Lookup(name); exists {
+			log.Warning("No module depends on '%s'. It will be deleted by the next 'dbt sync'.\n", name)
+		} else {
+			log.Warning("No module depends on '%s'.\n", name)
+		}
+		return
+	}
+
+	log.Log("'%s' is required through the following dependency paths:\n", name)
+	for _, edges := range paths {
+		log.IndentationLevel = 1
+		log.Log("%s\n", graph.Root)
+		for _, edge := range edges {
+			log.IndentationLevel++
+			log.Log("-> %s (version '%s', hash '%s')\n", edge.To, edge.Version, shortHash(edge.Hash))
+		}
+	}
+	log.IndentationLevel = 1
+	if count >= module.MaxCountedPaths {
+		log.Log("... and more than %d more paths.\n", count-len(paths))
+	} else if count > len(paths) {
+		log.Log("... and %d more paths.\n", count-len(paths))
+	}
+	log.IndentationLevel = 0
+
+	// The paths that are not printed might require other hashes.
+	hashes := map[string]bool{}
+	for _, edge := range graph.Edges {
+		if edge.To == name && (edge.From == graph.Root || graph.Reaches(graph.Root, edge.From)) {
+			hashes[edge.Hash] = true
+		}
+	}
+	if mod, exists := graph.Modules.Lookup(name); exists {
+		log.Log("Checked out hash: '%s'.\n", shortHash(mod.Head()))
+	}
+	if len(hashes) > 1 {
+		log.Warning("The dependency paths require %d different hashes of '%s'.\n", len(hashes), name)
+	}
+}
+
+func completeWorkspaceModules(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return []string{}, cobra.ShellCompDirectiveNoFileComp
+	}
+	modules := module.GetAllModules(util.GetWorkspaceRoot())
+	return modules.Keys(), cobra.ShellCompDirectiveNoFileComp
+}
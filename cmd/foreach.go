@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var foreachCmd = &cobra.Command{
+	Use:   "foreach [--type=TYPE] [--dirty] [-j N] -- COMMAND [ARGS...]",
+	Args:  cobra.MinimumNArgs(1),
+	Short: "Runs a command in every module of the workspace",
+	Long: `Runs a command in the root directory of every module of the workspace. The name, path and pinned hash
+of the module are available in the DBT_MODULE_NAME, DBT_MODULE_PATH and DBT_MODULE_HASH environment variables.
+Each line of output is prefixed with the name of the module. Fails if the command fails in any module.`,
+	Run: runForeach,
+}
+
+var foreachType string
+var foreachDirty bool
+var foreachJobs int
+
+func init() {
+	foreachCmd.Flags().StringVar(&foreachType, "type", "", "Only run the command in modules of this type (git, tar.gz or jj).")
+	foreachCmd.Flags().BoolVar(&foreachDirty, "dirty", false, "Only run the command in modules with uncommitted changes.")
+	foreachCmd.Flags().IntVarP(&foreachJobs, "jobs", "j", 1, "Run the command in up to N modules in parallel.")
+	rootCmd.AddCommand(foreachCmd)
+}
+
+func runForeach(cmd *cobra.Command, args []string) {
+	if foreachJobs < 1 {
+		log.Fatal("--jobs must be at least 1.\n")
+	}
+	var moduleType module.ModuleType
+	if foreachType != "" {
+		var ok bool
+		if moduleType, ok = module.ParseModuleTypeString(foreachType); !ok {
+			log.Fatal("Unknown module type '%s'. Use 'git', 'tar.gz' or 'jj'.\n", foreachType)
+		}
+	}
+
+	workspaceRoot := util.GetWorkspaceRoot()
+	graph := module.ReadDependencyGraph(workspaceRoot)
+	pins := pinnedDependencies(workspaceRoot, graph)
+
+	modules := []util.OrderedMapEntry[string, module.Module]{}
+	for _, entry := range graph.Modules.Entries() {
+		if foreachType != "" && entry.Value.Type() != moduleType {
+			continue
+		}
+		if foreachDirty && !entry.Value.IsDirty() {
+			continue
+		}
+		modules = append(modules, entry)
+	}
+
+	// Lines of output of different modules are written as a whole.
+	outputMutex := sync.Mutex{}
+	failed := make([]bool, len(modules))
+	indices := make(chan int)
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < foreachJobs; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indices {
+				name, mod := modules[idx].Key, modules[idx].Value
+				failed[idx] = !runInModule(name, mod, pins[name].Hash, args, &outputMutex)
+			}
+		}()
+	}
+	for idx := range modules {
+		indices <- idx
+	}
+	close(indices)
+	wg.Wait()
+
+	failedModules := []string{}
+	for idx, hasFailed := range failed {
+		if hasFailed {
+			failedModules = append(failedModules, modules[idx].Key)
+		}
+	}
+	if len(failedModules) > 0 {
+		log.Fatal("The command failed in %d of %d modules: %s.\n", len(failedModules), len(modules), strings.Join(failedModules, ", "))
+	}
+}
+
+// runInModule runs the command in the root directory of the module and reports whether it succeeded.
+func runInModule(name string, mod module.Module, hash string, args []string, outputMutex *sync.Mutex) bool {
+	command := exec.Command(args[0], args[1:]...)
+	command.Dir = mod.RootPath()
+	command.Env = append(os.Environ(),
+		"DBT_MODULE_NAME="+name,
+		"DBT_MODULE_PATH="+mod.RootPath(),
+		"DBT_MODULE_HASH="+hash,
+	)
+
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	command.Stdout = stdoutWriter
+	command.Stderr = stderrWriter
+
+	copyWg := sync.WaitGroup{}
+	copyWg.Add(2)
+	go copyPrefixed(name, stdout, os.Stdout, outputMutex, &copyWg)
+	go copyPrefixed(name, stderr, os.Stderr, outputMutex, &copyWg)
+
+	err := command.Run()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	copyWg.Wait()
+
+	if err != nil {
+		outputMutex.Lock()
+		log.Error("%s: %s\n", name, err)
+		outputMutex.Unlock()
+		return false
+	}
+	return true
+}
+
+func copyPrefixed(name string, reader io.Reader, writer io.Writer, outputMutex *sync.Mutex, wg *sync.WaitGroup) {
+	defer wg.Done()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		outputMutex.Lock()
+		fmt.Fprintf(writer, "[%s] %s\n", name, scanner.Text())
+		outputMutex.Unlock()
+	}
+	// Drain the pipe, so that the command does not block on long lines.
+	io.Copy(io.Discard, reader)
+}
@@ -55,7 +55,7 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 		workspaceRoot := util.GetWorkspaceRoot()
 		var err error
 
-		manifestNew, err = manifest.Generate(module.GetAllModules(workspaceRoot), true)
+		manifestNew, err = manifest.Generate(module.GetAllModules(workspaceRoot), module.ReadReplacements(workspaceRoot), true)
 		if err != nil {
 			// This is never expected to fail when allowUncommittedChanges is true, but in case it does...
 			log.Fatal("manifest.Generate failed unexpectedly: %s\n", err.Error())
@@ -160,6 +160,13 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 			if modifiedMod.New.Type != modifiedMod.Old.Type {
 				log.Log("Type changed from %q to %q\n", modifiedMod.Old.Type, modifiedMod.New.Type)
 			}
+			if modifiedMod.New.Replaced != modifiedMod.Old.Replaced {
+				if modifiedMod.New.Replaced {
+					log.Log("New module is replaced by a local directory\n")
+				} else {
+					log.Log("Old module is replaced by a local directory\n")
+				}
+			}
 			if modifiedMod.New.Dirty != modifiedMod.Old.Dirty {
 				if modifiedMod.New.Dirty {
 					log.Log("New module is dirty\n")
@@ -178,11 +185,17 @@ func runManifestDiff(cmd *cobra.Command, args []string) {
 func runManifestGenerate(cmd *cobra.Command, args []string) {
 	workspaceRoot := util.GetWorkspaceRoot()
 
-	manifest, err := manifest.Generate(module.GetAllModules(workspaceRoot), manifestAllowUncommittedChanges)
+	generatedManifest, err := manifest.Generate(module.GetAllModules(workspaceRoot), module.ReadReplacements(workspaceRoot), manifestAllowUncommittedChanges)
 	if err != nil {
 		log.Fatal("%s\n", err)
 	}
 
-	util.WriteYaml(manifestOutput, manifest)
+	if module.ReadModuleFile(workspaceRoot).UseLockFile {
+		if err := manifest.CheckLockFile(generatedManifest, module.ReadLockFile(workspaceRoot)); err != nil {
+			log.Fatal("%s.\n", err)
+		}
+	}
+
+	util.WriteYaml(manifestOutput, generatedManifest)
 	log.Success("Done.\n")
 }
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var restoreDepPurge bool
+var restoreDepOlderThan time.Duration
+
+var restoreDepCmd = &cobra.Command{
+	Use:   "restore-dep [NAME | --purge [--older-than=DURATION]]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Restores a module deleted by 'dbt sync'",
+	Long: `Modules that are no longer required are moved to the trash in DEPS/.trash/ by 'dbt sync'.
+Without arguments, lists all modules in the trash. Otherwise, moves the most recently deleted module NAME
+back to the DEPS/ directory. With --purge, deletes the modules in the trash for good, or only the ones
+that have been deleted longer than --older-than ago (e.g., 720h).`,
+	Run:               runRestoreDep,
+	ValidArgsFunction: completeTrashedModules,
+}
+
+func init() {
+	restoreDepCmd.Flags().BoolVar(&restoreDepPurge, "purge", false, "Delete the modules in the trash for good.")
+	restoreDepCmd.Flags().DurationVar(&restoreDepOlderThan, "older-than", 0, "Only purge the modules that have been deleted longer than this duration ago.")
+	rootCmd.AddCommand(restoreDepCmd)
+}
+
+func runRestoreDep(cmd *cobra.Command, args []string) {
+	workspaceRoot := util.GetWorkspaceRoot()
+	if restoreDepPurge {
+		if len(args) > 0 {
+			log.Fatal("--purge can not be used together with a module name.\n")
+		}
+		count := module.PurgeTrash(workspaceRoot, time.Now().Add(-restoreDepOlderThan))
+		log.Success("Deleted %d modules from the trash.\n", count)
+		return
+	}
+	if cmd.Flags().Changed("older-than") {
+		log.Fatal("--older-than can only be used together with --purge.\n")
+	}
+
+	entries := module.ReadTrash(workspaceRoot)
+
+	if len(args) == 0 {
+		if len(entries) == 0 {
+			log.Log("The trash is empty.\n")
+			return
+		}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "MODULE\tDELETED\tPATH")
+		for _, entry := range entries {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", entry.Name, entry.DeletedAt.Format("2006-01-02 15:04:05"), entry.Path)
+		}
+		writer.Flush()
+		return
+	}
+
+	name := args[0]
+	for _, entry := range entries {
+		if entry.Name != name {
+			continue
+		}
+		modulePath := module.RestoreFromTrash(workspaceRoot, entry)
+		log.Success("Restored '%s' to '%s'.\n", name, modulePath)
+		if _, count := module.ReadDependencyGraph(workspaceRoot).Paths(name, 0); count == 0 {
+			log.Warning("No module depends on '%s'. It will be deleted again by the next 'dbt sync'.\n", name)
+		}
+		return
+	}
+	log.Fatal("There is no module '%s' in the trash.\n", name)
+}
+
+func completeTrashedModules(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return []string{}, cobra.ShellCompDirectiveNoFileComp
+	}
+	names := []string{}
+	seen := map[string]bool{}
+	for _, entry := range module.ReadTrash(util.GetWorkspaceRoot()) {
+		if !seen[entry.Name] {
+			seen[entry.Name] = true
+			names = append(names, entry.Name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup [NAME]",
+	Args:  cobra.MaximumNArgs(1),
+	Short: "Runs the SETUP.go scripts of modules",
+	Long: `Runs the SETUP.go script of module NAME, or of all modules in the workspace, even if it has
+already run successfully. The setup policy of the user configuration and the top-level MODULE file applies.`,
+	Run:               runSetup,
+	ValidArgsFunction: completeWorkspaceModules,
+}
+
+func init() {
+	rootCmd.AddCommand(setupCmd)
+}
+
+func runSetup(cmd *cobra.Command, args []string) {
+	workspaceRoot := util.GetWorkspaceRoot()
+	policy := module.ReadSetupPolicy(workspaceRoot)
+	modules := module.GetAllModules(workspaceRoot)
+
+	names := modules.Keys()
+	if len(args) > 0 {
+		if _, exists := modules.Lookup(args[0]); !exists {
+			log.Fatal("There is no module '%s' in the workspace.\n", args[0])
+		}
+		names = args
+	}
+
+	for _, name := range names {
+		mod, _ := modules.Lookup(name)
+		if !module.HasSetupScript(mod.RootPath()) {
+			if len(args) > 0 {
+				log.Warning("Module '%s' has no SETUP.go file.\n", name)
+			}
+			continue
+		}
+		log.IndentationLevel = 0
+		log.Log("Setting up %s\n", name)
+		log.IndentationLevel = 1
+		module.SetupModule(mod.RootPath(), policy, true)
+		log.IndentationLevel = 0
+	}
+}
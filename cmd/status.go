@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/daedaleanai/cobra"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Args:  cobra.NoArgs,
+	Short: "Shows the state of all modules in the workspace",
+	Long: `Shows the type, checked out hash and dirty state of all modules in the workspace, whether they are
+checked out at their pinned hash, and how many commits they are ahead of or behind their remote branch.`,
+	Run: runStatus,
+}
+
+var statusFormat string
+
+func init() {
+	statusCmd.Flags().StringVar(&statusFormat, "format", "table", "Output format (table or json).")
+	rootCmd.AddCommand(statusCmd)
+}
+
+type moduleStatus struct {
+	Name string
+	Path string
+	Type string
+	Head string
+	// Pinned is the hash that sync checks out, or empty if the module is not pinned.
+	Pinned    string `json:",omitempty"`
+	AtPinned  bool
+	Dirty     bool
+	Workspace bool `json:",omitempty"`
+	Replaced  bool `json:",omitempty"`
+	// Untracked modules are not required by any module and are deleted by the next sync.
+	Untracked bool `json:",omitempty"`
+	// Upstream is the remote branch that the ahead / behind counts refer to.
+	Upstream string `json:",omitempty"`
+	Ahead    int
+	Behind   int
+}
+
+func runStatus(cmd *cobra.Command, args []string) {
+	if statusFormat != "table" && statusFormat != "json" {
+		log.Fatal("Unknown status format '%s'. Use 'table' or 'json'.\n", statusFormat)
+	}
+
+	workspaceRoot := util.GetWorkspaceRoot()
+	graph := module.ReadDependencyGraph(workspaceRoot)
+	replacements := module.ReadReplacements(workspaceRoot)
+	pins := pinnedDependencies(workspaceRoot, graph)
+
+	statuses := []moduleStatus{}
+	for _, entry := range graph.Modules.Entries() {
+		name, mod := entry.Key, entry.Value
+		_, isReplaced := replacements[name]
+		status := moduleStatus{
+			Name:      name,
+			Path:      mod.RootPath(),
+			Type:      mod.Type().String(),
+			Dirty:     mod.IsDirty(),
+			Workspace: name == graph.Root,
+			Replaced:  isReplaced,
+			Untracked: name != graph.Root && !graph.Reaches(graph.Root, name),
+		}
+		if !status.Workspace {
+			status.Head = mod.Head()
+			status.Pinned = pins[name].Hash
+			status.AtPinned = status.Pinned != "" && status.Head == status.Pinned
+		}
+		if gitMod, ok := mod.(module.GitModule); ok {
+			status.Upstream = upstreamOf(gitMod, pins[name].Version)
+			if status.Upstream != "" {
+				status.Ahead, status.Behind, _ = gitMod.AheadBehind(status.Upstream)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	if statusFormat == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(statuses); err != nil {
+			log.Fatal("Failed to encode status: %s.\n", err)
+		}
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "MODULE\tTYPE\tHEAD\tPINNED\tDIRTY\tUPSTREAM\tAHEAD\tBEHIND")
+	untracked := []string{}
+	for _, status := range statuses {
+		pinned := "no"
+		switch {
+		case status.Workspace:
+			pinned = "workspace"
+		case status.Replaced:
+			pinned = "replaced"
+		case status.Untracked:
+			pinned = "untracked"
+			untracked = append(untracked, status.Name)
+		case status.AtPinned:
+			pinned = "yes"
+		case status.Pinned == "":
+			pinned = "unknown"
+		default:
+			pinned = fmt.Sprintf("no (%s)", shortHash(status.Pinned))
+		}
+		dirty := ""
+		if status.Dirty {
+			dirty = "dirty"
+		}
+		aheadBehind := "\t"
+		if status.Upstream != "" {
+			aheadBehind = fmt.Sprintf("%d\t%d", status.Ahead, status.Behind)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", status.Name, status.Type, shortHash(status.Head), pinned, dirty, status.Upstream, aheadBehind)
+	}
+	writer.Flush()
+
+	if len(untracked) > 0 {
+		log.Warning("The following modules are not required by any module and will be deleted by the next 'dbt sync': %s.\n", strings.Join(untracked, ", "))
+	}
+}
+
+// pinnedDependencies returns the dependency that determines the pinned hash of each module.
+// As in sync, the dependencies of modules closer to the workspace module take precedence.
+func pinnedDependencies(workspaceRoot string, graph module.DependencyGraph) map[string]module.Dependency {
+	pins := map[string]module.Dependency{}
+	queue := []string{graph.Root}
+	visited := map[string]bool{graph.Root: true}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range graph.EdgesFrom(current) {
+			if _, isPinned := pins[edge.To]; !isPinned {
+				pins[edge.To] = edge.Dependency
+			}
+			if !visited[edge.To] {
+				visited[edge.To] = true
+				queue = append(queue, edge.To)
+			}
+		}
+	}
+
+	// In lock file mode, all hashes are pinned in the lock file.
+	if module.ReadModuleFile(workspaceRoot).UseLockFile {
+		for name, locked := range module.ReadLockFile(workspaceRoot).Dependencies {
+			dep := pins[name]
+			dep.Hash = locked.Hash
+			pins[name] = dep
+		}
+	}
+	return pins
+}
+
+// upstreamOf returns the remote branch that the module is compared against: the branch tracked
+// by the current branch or, if HEAD is detached, the version of the dependency if it is a branch.
+func upstreamOf(mod module.GitModule, version string) string {
+	if upstream, err := mod.Upstream(); err == nil {
+		return upstream
+	}
+	if version == "" || util.IsVersionConstraint(version) {
+		return ""
+	}
+	if _, tagged := mod.Tags()[version]; tagged {
+		return ""
+	}
+	if _, _, err := mod.AheadBehind(version); err != nil {
+		return ""
+	}
+	return version
+}
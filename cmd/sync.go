@@ -2,11 +2,15 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/module"
@@ -25,14 +29,36 @@ declared in the MODULE files of each module, starting from the top-level MODULE
 }
 
 var update bool
+var updateOnly []string
 var ignoreErrors bool
 var strict bool
+var syncJobs int
+var syncDryRun bool
+var syncFetch bool
+var syncFormat string
+var syncOffline bool
+var syncForce bool
+var syncSaveUnpushed bool
+var syncNoSetup bool
+var syncNoHooks bool
+var syncAllowSymlinks []string
 
 func init() {
 	// Whether to use 'master' instead of the version specified in the MODULE file.
 	syncCmd.Flags().BoolVar(&update, "update", false, "Recompute all dependency hashes based on the version string.")
+	syncCmd.Flags().StringSliceVar(&updateOnly, "update-only", nil, "Recompute the hashes of the given dependencies based on the version string and keep all other hashes.")
 	syncCmd.Flags().BoolVar(&ignoreErrors, "ignore-errors", false, "Ignore all errors while pinning and checking dependencies.")
 	syncCmd.Flags().BoolVar(&strict, "strict", false, "Check that all dependency hashes are present and the chosen commit is an ancestor of the commit described by version string.")
+	syncCmd.Flags().IntVarP(&syncJobs, "jobs", "j", 1, "Clone and fetch up to N modules in parallel.")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Print the changes sync would make to the workspace without applying them.")
+	syncCmd.Flags().BoolVar(&syncFetch, "fetch", false, "Fetch the existing modules and create missing mirrors in a dry run, to resolve hashes from the latest remote refs.")
+	syncCmd.Flags().StringVar(&syncFormat, "format", "text", "Format of the plan printed by --dry-run (text or json).")
+	syncCmd.Flags().BoolVar(&syncOffline, "offline", false, "Do not access the network. Resolve hashes only from the local mirror and the modules in DEPS/.")
+	syncCmd.Flags().BoolVar(&syncForce, "force", false, "Delete modules that are no longer required even if they have uncommitted changes or unpushed commits.")
+	syncCmd.Flags().BoolVar(&syncSaveUnpushed, "save-unpushed", false, "Save commits that are not on any remote branch to a 'dbt/saved/<timestamp>' branch before checking out a module.")
+	syncCmd.Flags().BoolVar(&syncNoSetup, "no-setup", false, "Do not run the SETUP.go scripts of modules.")
+	syncCmd.Flags().BoolVar(&syncNoHooks, "no-hooks", false, "Do not run the pre-sync, post-checkout and post-sync hooks of modules.")
+	syncCmd.Flags().StringSliceVar(&syncAllowSymlinks, "allow-symlink", nil, "Allow symlinks in archives that point to the given paths (or below them) outside of the module directory.")
 	rootCmd.AddCommand(syncCmd)
 }
 
@@ -40,22 +66,54 @@ func runSync(cmd *cobra.Command, args []string) {
 	if update && strict {
 		log.Fatal("--update and --strict can not be used together.\n")
 	}
+	if len(updateOnly) > 0 && (update || strict) {
+		log.Fatal("--update-only can not be used together with --update or --strict.\n")
+	}
+	if syncJobs < 1 {
+		log.Fatal("--jobs must be at least 1.\n")
+	}
+	if syncFormat != "text" && syncFormat != "json" {
+		log.Fatal("Unknown plan format '%s'. Use 'text' or 'json'.\n", syncFormat)
+	}
+	if syncFetch && !syncDryRun {
+		log.Fatal("--fetch can only be used together with --dry-run.\n")
+	}
+
+	module.Offline = syncOffline
+	module.ReadOnly = syncDryRun && !syncFetch
+	// Progress lines of parallel downloads would overwrite each other.
+	module.DownloadProgress = module.DownloadProgress && syncJobs == 1
+	for _, target := range syncAllowSymlinks {
+		absTarget, err := filepath.Abs(target)
+		if err != nil {
+			log.Fatal("Invalid symlink target '%s': %s.\n", target, err)
+		}
+		module.AllowedSymlinkTargets = append(module.AllowedSymlinkTargets, absTarget)
+	}
 
 	workspaceRoot := util.GetWorkspaceRoot()
 	log.Debug("Workspace: %s.\n", workspaceRoot)
 
 	workspaceModuleFile := module.ReadModuleFile(workspaceRoot)
+	for _, name := range updateOnly {
+		if _, exists := workspaceModuleFile.Dependencies[name]; !exists {
+			log.Fatal("'%s' is not a dependency of the workspace module. Only direct dependencies can be updated.\n", name)
+		}
+	}
 	workspaceModuleName := module.OpenModule(workspaceRoot).Name()
 	log.Debug("Workspace module name: '%s'\n", workspaceModuleName)
 
-	// Ensure DEPS/ directory exists, and warn if it seems to be mangled by the user.
-	util.EnsureManagedDir(util.DepsDirName)
-
 	workspaceModuleSymlink := ""
 	if workspaceModuleFile.Layout != "cpp" {
-		// Create the DEPS/ subdirectory and create a symlink to the top-level module.
 		workspaceModuleSymlink = path.Join(workspaceRoot, util.DepsDirName, workspaceModuleName)
-		if !util.DirExists(workspaceModuleSymlink) {
+	}
+
+	if !syncDryRun {
+		// Ensure DEPS/ directory exists, and warn if it seems to be mangled by the user.
+		util.EnsureManagedDir(util.DepsDirName)
+
+		// Create the DEPS/ subdirectory and create a symlink to the top-level module.
+		if workspaceModuleSymlink != "" && !util.DirExists(workspaceModuleSymlink) {
 			log.Debug("Creating symlink for the workspace module: '%s/%s' -> '%s'.\n", util.DepsDirName, workspaceModuleName, workspaceRoot)
 			util.MkdirAll(path.Dir(workspaceModuleSymlink))
 			err := os.Symlink("..", workspaceModuleSymlink)
@@ -73,145 +131,907 @@ func runSync(cmd *cobra.Command, args []string) {
 		errorFunc = log.Warning
 	}
 
+	if !syncDryRun && !syncNoHooks {
+		runPreSyncHooks(workspaceRoot, workspaceModuleName, workspaceModuleFile, module.ReadSetupPolicy(workspaceRoot))
+		// Pre-sync hooks may change the MODULE file.
+		workspaceModuleFile = module.ReadModuleFile(workspaceRoot)
+	}
+
+	resolver := newSyncResolver(workspaceRoot, workspaceModuleFile, workspaceModuleSymlink, errorFunc)
+	plan := resolver.resolve()
+
+	if syncDryRun {
+		printSyncPlan(plan, syncFormat)
+	}
+
+	if len(resolver.missing) > 0 {
+		log.Error("The following dependencies are not available offline:\n  %s\n", strings.Join(resolver.missing, "\n  "))
+		log.Fatal("Run 'dbt sync' without --offline to fetch them, or add them to the mirror.\n")
+	}
+
+	if protected := protectedDeletions(plan.Deletions); len(protected) > 0 {
+		message := fmt.Sprintf("The following modules are no longer required, but have local changes:\n  %s\n", strings.Join(protected, "\n  "))
+		if !syncDryRun && !syncForce {
+			log.Error("%s", message)
+			log.Fatal("Commit and push the changes, or use --force to move the modules to the trash anyway.\n")
+		}
+		log.Warning("%s", message)
+	}
+
+	if unpushed := unpushedCheckouts(plan); len(unpushed) > 0 {
+		message := fmt.Sprintf("Checking out the following modules detaches commits that are not on any remote branch:\n  %s\n", strings.Join(unpushed, "\n  "))
+		if !syncDryRun && !syncSaveUnpushed {
+			log.Error("%s", message)
+			log.Fatal("Push the commits, or use --save-unpushed to save them to a branch before checking out.\n")
+		}
+		log.Warning("%s", message)
+	}
+
+	if syncDryRun {
+		return
+	}
+
+	resolver.apply(plan)
+	if !syncNoHooks {
+		resolver.runPostSyncHooks(workspaceModuleName, plan)
+	}
+
+	if len(resolver.replacements) > 0 {
+		log.Warning("%d dependencies are replaced by local directories. Their hashes have not been updated.\n", len(resolver.replacements))
+	}
+
+	log.Success("Done.\n")
+}
+
+// syncResolver resolves the hashes of all direct and transitive dependencies of the workspace and
+// computes the plan that brings the workspace into the resolved state. The resolver only clones
+// missing modules and fetches existing ones, all other changes to the workspace are left to `apply`.
+type syncResolver struct {
+	workspaceRoot          string
+	workspaceModuleFile    module.ModuleFile
+	workspaceModuleSymlink string
+	errorFunc              func(string, ...interface{})
+
+	// In lock file mode the resolved hashes are kept in MODULE.lock.
+	lockFile module.LockFile
+
+	// Dependencies that are replaced by local directories are symlinked into the DEPS/ directory.
+	replacements map[string]string
+
+	// Symlinks of dependencies that are no longer replaced.
+	staleReplacements map[string]bool
+
+	// Restricts which modules run their SETUP.go script.
+	setupPolicy module.SetupPolicy
+
 	// Modules that have been processed.
-	done := map[string]bool{}
+	done map[string]bool
 
 	// Modules that have been fetched.
-	fetched := map[string]bool{}
+	fetched map[string]bool
 
-	// Modules that still need to be processed.
-	queue := []string{workspaceRoot}
+	// Modules that have been cloned by the resolver.
+	cloned map[string]bool
+
+	// Modules that exist on disk, indexed by their path.
+	modules map[string]module.Module
+
+	// Pinned dependency URLs / subdirectories / hashes.
+	pinnedUrls    map[string]string
+	pinnedSubdirs map[string]string
+	pinnedHashes  map[string]string
 
-	// Pinned dependency URLs / hashes.
-	pinnedUrls := map[string]string{}
-	pinnedHashes := map[string]string{}
+	// The module and version string that caused each dependency hash to be pinned.
+	pinnedBy map[string]versionRequirement
+
+	// Dependencies selected by --update-only, and the modules whose pins conflict with the newly resolved hashes.
+	updated         map[string]bool
+	updateConflicts map[string][]string
+
+	// Dependencies (and their hashes) that are not available locally in --offline mode.
+	missing      []string
+	missingNames map[string]bool
+
+	plan syncPlan
+
+	// The MODULE and MODULE.lock files with the resolved hashes.
+	resolvedModuleFile module.ModuleFile
+	resolvedLockFile   module.LockFile
+}
+
+func newSyncResolver(workspaceRoot string, workspaceModuleFile module.ModuleFile, workspaceModuleSymlink string, errorFunc func(string, ...interface{})) *syncResolver {
+	r := &syncResolver{
+		workspaceRoot:          workspaceRoot,
+		workspaceModuleFile:    workspaceModuleFile,
+		workspaceModuleSymlink: workspaceModuleSymlink,
+		errorFunc:              errorFunc,
+		lockFile:               module.ReadLockFile(workspaceRoot),
+		replacements:           module.ReadReplacements(workspaceRoot),
+		staleReplacements:      map[string]bool{},
+		setupPolicy:            module.ReadSetupPolicy(workspaceRoot),
+		done:                   map[string]bool{},
+		fetched:                map[string]bool{},
+		cloned:                 map[string]bool{},
+		modules:                map[string]module.Module{},
+		pinnedUrls:             map[string]string{},
+		pinnedSubdirs:          map[string]string{},
+		pinnedHashes:           map[string]string{},
+		pinnedBy:               map[string]versionRequirement{},
+		missingNames:           map[string]bool{},
+		updated:                map[string]bool{},
+		updateConflicts:        map[string][]string{},
+	}
+
+	if workspaceModuleFile.UseLockFile {
+		log.Debug("Using hashes from %s.\n", util.LockFileName)
+	}
+	for _, name := range updateOnly {
+		r.updated[name] = true
+	}
+	module.CheckLocalFileIgnored(workspaceRoot)
+	for _, entry := range util.OrderedEntries(r.replacements) {
+		log.Warning("Dependency '%s' is replaced by local directory '%s'.\n", entry.Key, entry.Value)
+	}
+	r.removeStaleReplacements()
+	return r
+}
+
+func (r *syncResolver) resolve() syncPlan {
+	// Modules that still need to be processed.
+	queue := []string{r.workspaceRoot}
 
 	for len(queue) > 0 {
-		modulePath := queue[0]
-		queue = queue[1:]
-		if done[modulePath] {
-			continue
+		// The hashes of all modules in the queue have been pinned at this point, so the dependencies
+		// they declare can be cloned and fetched in parallel. Pinning stays sequential below to keep
+		// the result independent of the number of jobs.
+		r.prefetchDependencies(queue)
+
+		level := queue
+		queue = []string{}
+		for _, modulePath := range level {
+			if r.done[modulePath] {
+				continue
+			}
+			r.done[modulePath] = true
+			queue = append(queue, r.processModule(modulePath)...)
 		}
-		done[modulePath] = true
+	}
 
-		moduleName := path.Base(modulePath)
-		log.IndentationLevel = 0
-		log.Log("Processing %s\n", moduleName)
+	log.IndentationLevel = 0
+	for _, name := range util.OrderedKeys(r.updateConflicts) {
+		r.errorFunc("Hash '%s' selected for '%s' by --update-only conflicts with the pins of other modules:\n  %s\nUpdate these modules to the new hash as well, or keep the previous hash of '%s'.\n",
+			shortHash(r.pinnedHashes[name]), name, strings.Join(r.updateConflicts[name], "\n  "), name)
+	}
+
+	r.warnDivergentSubdirs()
+
+	r.plan.Deletions = r.staleDependencies()
+	r.resolveModuleFiles()
+	return r.plan
+}
+
+// warnDivergentSubdirs warns about dependencies in subdirectories of the same repository that are
+// pinned to different hashes. Each of them has its own clone in DEPS/.repos/, so they can be pinned
+// independently, but the subdirectories then see different revisions of the repository.
+func (r *syncResolver) warnDivergentSubdirs() {
+	namesByUrl := map[string][]string{}
+	for _, name := range util.OrderedKeys(r.pinnedSubdirs) {
+		if _, isReplaced := r.replacements[name]; r.pinnedSubdirs[name] != "" && !isReplaced && r.pinnedHashes[name] != "" {
+			namesByUrl[r.pinnedUrls[name]] = append(namesByUrl[r.pinnedUrls[name]], name)
+		}
+	}
+
+	for _, url := range util.OrderedKeys(namesByUrl) {
+		names := namesByUrl[url]
+		pins := []string{}
+		divergent := false
+		for _, name := range names {
+			pins = append(pins, fmt.Sprintf("'%s' (hash '%s')", name, shortHash(r.pinnedHashes[name])))
+			divergent = divergent || r.pinnedHashes[name] != r.pinnedHashes[names[0]]
+		}
+		if divergent {
+			log.Warning("Dependencies in subdirectories of '%s' are pinned to different hashes: %s.\n", url, strings.Join(pins, ", "))
+		}
+	}
+}
+
+// processModule pins the dependencies of a module and returns their paths.
+func (r *syncResolver) processModule(modulePath string) []string {
+	moduleName := path.Base(modulePath)
+	log.IndentationLevel = 0
+	log.Log("Processing %s\n", moduleName)
+	log.IndentationLevel = 1
+
+	moduleFile, isKnown := r.readModuleFile(modulePath)
+	if !isKnown {
+		log.Log("Dependencies are unknown until the module is cloned\n\n")
+		return nil
+	}
+
+	if len(moduleFile.Dependencies) == 0 {
+		log.Log("Has no dependencies\n\n")
+		return nil
+	}
+
+	depModulePaths := []string{}
+	for _, name := range dependencyNames(moduleFile) {
 		log.IndentationLevel = 1
+		log.Log("Depends on %s\n", name)
+		log.IndentationLevel = 2
 
-		moduleFile := module.ReadModuleFile(modulePath)
+		depModulePaths = append(depModulePaths, path.Join(r.workspaceRoot, util.DepsDirName, name))
+		r.processDependency(moduleName, name, moduleFile.Dependencies[name])
+		log.Log("\n")
+	}
+	return depModulePaths
+}
 
-		if len(moduleFile.Dependencies) == 0 {
-			log.IndentationLevel = 1
-			log.Log("Has no dependencies\n\n")
-			continue
+// processDependency pins the hash of dependency `name` required by module `moduleName`.
+func (r *syncResolver) processDependency(moduleName, name string, dep module.Dependency) {
+	depModulePath := path.Join(r.workspaceRoot, util.DepsDirName, name)
+	errorFunc := r.errorFunc
+
+	// Check that the dependency URL matches the pinned URL for that module.
+	if _, isUrlPinned := r.pinnedUrls[name]; !isUrlPinned {
+		r.pinnedUrls[name] = dep.URL
+		log.Debug("Pinning URL to '%s'.\n", dep.URL)
+	}
+	if dep.URL != r.pinnedUrls[name] {
+		errorFunc("Dependency requires URL '%s', but URL has been pinned to '%s'.\n", dep.URL, r.pinnedUrls[name])
+	}
+
+	// The same applies to the subdirectory of the repository.
+	if _, isSubdirPinned := r.pinnedSubdirs[name]; !isSubdirPinned {
+		r.pinnedSubdirs[name] = dep.Subdir
+	}
+	if dep.Subdir != r.pinnedSubdirs[name] {
+		errorFunc("Dependency requires subdirectory '%s', but subdirectory has been pinned to '%s'.\n", dep.Subdir, r.pinnedSubdirs[name])
+	}
+
+	// Replaced dependencies are not pinned.
+	if replacement, isReplaced := r.replacements[name]; isReplaced {
+		if info, err := os.Lstat(depModulePath); err == nil && (info.Mode()&os.ModeSymlink) != os.ModeSymlink {
+			log.Fatal("'%s' is a checked out module. Remove it to replace it with a local directory.\n", depModulePath)
 		}
+		log.Warning("Using local directory '%s'.\n", replacement)
+		r.planModule(plannedModule{Name: name, Path: depModulePath, URL: dep.URL, Version: dep.Version, Replacement: replacement})
+		return
+	}
 
-		for _, name := range dependencyNames(moduleFile) {
-			log.IndentationLevel = 1
-			log.Log("Depends on %s\n", name)
-			log.IndentationLevel = 2
+	// Determine the commit hash for this dependency.
 
-			dep := moduleFile.Dependencies[name]
-			depModulePath := path.Join(workspaceRoot, util.DepsDirName, name)
-			queue = append(queue, depModulePath)
+	// In lock file mode, the hashes of the workspace module's dependencies are taken from
+	// the lock file, unless the dependency has been changed in the MODULE file since it was
+	// locked. Other modules only fall back to the lock file if they don't set a hash.
+	if locked, isLocked := r.lockFile.Dependencies[name]; r.workspaceModuleFile.UseLockFile && isLocked && locked.URL == dep.URL {
+		if (len(r.done) == 1 && locked.Version == dep.Version) || dep.Hash == "" {
+			dep.Hash = locked.Hash
+		}
+	}
 
-			// Check that the dependency URL matches the pinned URL for that module.
-			if _, isUrlPinned := pinnedUrls[name]; !isUrlPinned {
-				pinnedUrls[name] = dep.URL
-				log.Debug("Pinning URL to '%s'.\n", dep.URL)
-			}
-			if dep.URL != pinnedUrls[name] {
-				errorFunc("Dependency requires URL '%s', but URL has been pinned to '%s'.\n", dep.URL, pinnedUrls[name])
-			}
+	// In --strict mode all hashes must be set in the MODULE file.
+	if strict && dep.Hash == "" {
+		errorFunc("Hash must not be empty in --strict mode.\n")
+	}
 
-			// Check that the on-disk module has the same URL.
-			depModule := module.OpenOrCreateModule(depModulePath, dep.URL, dep.Type, dep.Hash)
-			if depModule.URL() != dep.URL {
-				errorFunc("Dependency requires URL '%s', but the on-disk module has URL '%s'.\n", dep.URL, depModule.URL())
-			}
+	depModule, exists := r.modules[depModulePath]
+	if !exists {
+		// Modules are not cloned in a dry run, so nothing but the hash in the MODULE file is known.
+		if _, isHashPinned := r.pinnedHashes[name]; !isHashPinned && dep.Hash != "" {
+			r.pinnedHashes[name] = dep.Hash
+			r.pinnedBy[name] = versionRequirement{moduleName, dep.Version}
+		}
+		if module.Offline && !module.IsAvailableOffline(depModulePath, dep.URL, dep.Type) {
+			log.Log("Module is neither cloned nor available in the local mirror.\n")
+			r.addMissing(name, r.pinnedHashes[name], moduleName, dep.Version)
+		} else {
+			log.Log("Module has not been cloned yet. Its hash can not be checked.\n")
+		}
+		r.planModule(plannedModule{
+			Name:       name,
+			Path:       depModulePath,
+			URL:        dep.URL,
+			Type:       module.DetermineModuleType(dep.URL, dep.Type).String(),
+			Version:    dep.Version,
+			Hash:       r.pinnedHashes[name],
+			Clone:      true,
+			Unresolved: true,
+		})
+		return
+	}
 
-			// Make sure we have the latest changes and the working tree is clean.
-			if _, hasBeenFetched := fetched[depModulePath]; !hasBeenFetched {
-				depModule.Fetch()
-				fetched[depModulePath] = true
-			}
-			if depModule.IsDirty() {
-				errorFunc("The exiting module has local changes.\n")
-			}
+	// Check that the on-disk module has the same URL.
+	if depModule.URL() != dep.URL {
+		errorFunc("Dependency requires URL '%s', but the on-disk module has URL '%s'.\n", dep.URL, depModule.URL())
+	}
 
-			// Determine the commit hash for this dependency.
+	// Make sure we have the latest changes and the working tree is clean.
+	if _, hasBeenFetched := r.fetched[depModulePath]; !hasBeenFetched {
+		depModule.Fetch()
+		r.fetched[depModulePath] = true
+	}
+	if depModule.IsDirty() {
+		errorFunc("The exiting module has local changes.\n")
+	}
 
-			// In --strict mode all hashes must be set in the MODULE file.
-			if strict && dep.Hash == "" {
-				errorFunc("Hash must not be empty in --strict mode.\n")
-			}
+	// Resolve the version string to a hash if we are currently processsing the
+	// workspace module (only one module is "done") and the hash is not set yet or
+	// --update is used to force re-resolution of the version string to a hash.
+	// --update-only does the same for the selected dependencies.
+	if (update || r.updated[name] || dep.Hash == "") && len(r.done) == 1 {
+		dep.Hash = depModule.RevParse(resolveVersionRef(depModule, dep.Version))
+		log.Debug("Resolved dependency version '%s' to hash '%s'.\n", dep.Version, shortHash(dep.Hash))
+	}
+
+	log.Log("Using hash '%s' for version '%s'.\n", shortHash(dep.Hash), dep.Version)
+
+	if module.Offline && !depModule.HasCommit(dep.Hash) {
+		log.Log("Hash is not available locally.\n")
+		r.addMissing(name, dep.Hash, moduleName, dep.Version)
+		r.planModule(plannedModule{
+			Name:       name,
+			Path:       depModulePath,
+			URL:        dep.URL,
+			Type:       depModule.Type().String(),
+			Version:    dep.Version,
+			Head:       depModule.Head(),
+			Hash:       dep.Hash,
+			Unresolved: true,
+		})
+		return
+	}
 
-			// Resolve the version string to a hash if we are currently processsing the
-			// workspace module (only one module is "done") and the hash is not set yet or
-			// --update is used to force re-resolution of the version string to a hash.
-			if (update || dep.Hash == "") && len(done) == 1 {
-				dep.Hash = depModule.RevParse(dep.Version)
-				log.Debug("Resolved dependency version '%s' to hash '%s'.\n", dep.Version, dep.Hash[:7])
+	if util.IsVersionConstraint(dep.Version) {
+		// Check that the dependency hash is tagged with a version in the requested range.
+		if _, ok := matchingTagForHash(depModule, dep.Hash, dep.Version); !ok {
+			errorFunc("The dependency hash ('%s') is not tagged with a version that satisfies '%s'.\n", shortHash(dep.Hash), dep.Version)
+		}
+	} else if !depModule.IsAncestor(dep.Hash, dep.Version) {
+		// Check that the dependency hash is part of the tree that is referenced by the version string.
+		errorFunc(
+			"The dependency hash ('%s') is not an ancestor of the commit ('%s') the version string ('%s') currently resolves to.\n",
+			shortHash(dep.Hash), shortHash(depModule.RevParse(dep.Version)), dep.Version)
+	}
+
+	// Check the dependency hash against the fixed hash for that module.
+	if _, isHashPinned := r.pinnedHashes[name]; !isHashPinned {
+		r.pinnedHashes[name] = dep.Hash
+		r.pinnedBy[name] = versionRequirement{moduleName, dep.Version}
+	}
+	pinnedHash := r.pinnedHashes[name]
+	if dep.Hash != pinnedHash {
+		conflictFunc := errorFunc
+		if r.updated[name] {
+			// Conflicts with a hash selected by --update-only are collected, so that they can be
+			// reported together once all modules have been processed.
+			conflictFunc = func(format string, a ...interface{}) {
+				r.updateConflicts[name] = append(r.updateConflicts[name], strings.TrimSpace(fmt.Sprintf(format, a...)))
 			}
+		}
 
-			log.Log("Using hash '%s' for version '%s'.\n", dep.Hash[:7], dep.Version)
+		if util.IsVersionConstraint(dep.Version) {
+			// Version ranges accept any pinned hash that is tagged with a version in the range.
+			checkPinnedVersion(depModule, pinnedHash, r.pinnedBy[name], versionRequirement{moduleName, dep.Version}, conflictFunc)
+		} else if r.updated[name] {
+			conflictFunc("Module '%s' requires hash '%s' for version '%s'.", moduleName, shortHash(dep.Hash), dep.Version)
+		} else {
+			errorFunc("Dependency requires hash '%s', but hash has been pinned to '%s'.\n", shortHash(dep.Hash), shortHash(pinnedHash))
+		}
+	}
 
-			// Check that the dependency hash is part of the tree that is referenced by the version string.
-			if !depModule.IsAncestor(dep.Hash, dep.Version) {
-				errorFunc(
-					"The dependency hash ('%s') is not an ancestor of the commit ('%s') the version string ('%s') currently resolves to.\n",
-					dep.Hash[:7], depModule.RevParse(dep.Version)[:7], dep.Version)
+	head := depModule.Head()
+	checkout := head != pinnedHash
+	unpushed := 0
+	if gitModule, isGit := depModule.(module.GitModule); isGit && checkout && !r.cloned[depModulePath] {
+		var err error
+		if unpushed, err = gitModule.UnpushedCommits("HEAD"); err != nil {
+			log.Fatal("Failed to determine the unpushed commits of '%s': %s.\n", name, err)
+		}
+	}
+	r.planModule(plannedModule{
+		Name:     name,
+		Path:     depModulePath,
+		URL:      dep.URL,
+		Type:     depModule.Type().String(),
+		Version:  dep.Version,
+		Head:     head,
+		Hash:     pinnedHash,
+		Clone:    r.cloned[depModulePath],
+		Checkout: checkout,
+		Setup:    !syncNoSetup && (checkout || r.cloned[depModulePath]) && r.setupPolicy.IsAllowed(name) && module.SetupPending(depModule, pinnedHash),
+		Unpushed: unpushed,
+	})
+}
+
+// addMissing records a dependency hash that is not available in --offline mode.
+func (r *syncResolver) addMissing(name, hash, requiredBy, version string) {
+	if _, isMissing := r.missingNames[name]; isMissing {
+		return
+	}
+	r.missingNames[name] = true
+	if hash == "" {
+		hash = "<unknown hash>"
+	}
+	r.missing = append(r.missing, fmt.Sprintf("%s %s (version '%s', required by %s)", name, hash, version, requiredBy))
+}
+
+// planModule adds a dependency to the plan, unless it has been planned before.
+func (r *syncResolver) planModule(mod plannedModule) {
+	for _, planned := range r.plan.Modules {
+		if planned.Name == mod.Name {
+			return
+		}
+	}
+	r.plan.Modules = append(r.plan.Modules, mod)
+}
+
+// readModuleFile reads the MODULE file of a module as of its pinned hash. It reports false if the
+// module has not been cloned yet, in which case its dependencies are unknown.
+func (r *syncResolver) readModuleFile(modulePath string) (module.ModuleFile, bool) {
+	if modulePath == r.workspaceRoot {
+		return module.ReadModuleFile(modulePath), true
+	}
+
+	name := path.Base(modulePath)
+	if replacement, isReplaced := r.replacements[name]; isReplaced {
+		return module.ReadModuleFile(replacement), true
+	}
+
+	mod, exists := r.modules[modulePath]
+	hash := r.pinnedHashes[name]
+	if !exists || hash == "" {
+		return module.ModuleFile{}, false
+	}
+	return module.ReadModuleFileAt(mod, hash), true
+}
+
+// staleDependencies returns everything in the DEPS/ directory that does not belong there.
+func (r *syncResolver) staleDependencies() []string {
+	depsDir := path.Join(r.workspaceRoot, util.DepsDirName)
+	content, err := ioutil.ReadDir(depsDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("%v", err)
+	}
+
+	stale := []string{}
+	for _, info := range content {
+		fullPath := path.Join(depsDir, info.Name())
+		if info.Name() == util.SubdirReposDirName {
+			stale = append(stale, r.staleSubdirRepositories()...)
+			continue
+		}
+		if info.Name() == util.TrashDirName {
+			continue
+		}
+		if !r.done[fullPath] && fullPath != r.workspaceModuleSymlink && info.Name() != util.WarningFileName {
+			stale = append(stale, fullPath)
+		}
+	}
+	return stale
+}
+
+// staleSubdirRepositories returns the repositories in DEPS/.repos/ that no dependency uses a subdirectory of.
+func (r *syncResolver) staleSubdirRepositories() []string {
+	reposDir := path.Join(r.workspaceRoot, util.DepsDirName, util.SubdirReposDirName)
+	content, err := ioutil.ReadDir(reposDir)
+	if err != nil {
+		log.Fatal("%v", err)
+	}
+
+	stale := []string{}
+	for _, info := range content {
+		depModulePath := path.Join(r.workspaceRoot, util.DepsDirName, info.Name())
+		if !r.done[depModulePath] || r.pinnedSubdirs[info.Name()] == "" {
+			stale = append(stale, path.Join(reposDir, info.Name()))
+		}
+	}
+	return stale
+}
+
+// unpushedCheckouts describes the modules whose checkout detaches commits that are not on any remote branch.
+func unpushedCheckouts(plan syncPlan) []string {
+	unpushed := []string{}
+	for _, mod := range plan.Modules {
+		if mod.Checkout && mod.Unpushed > 0 {
+			unpushed = append(unpushed, fmt.Sprintf("%s (%d commits)", mod.Name, mod.Unpushed))
+		}
+	}
+	return unpushed
+}
+
+// protectedDeletions describes the stale modules that have uncommitted changes or unpushed commits.
+func protectedDeletions(stalePaths []string) []string {
+	protected := []string{}
+	for _, stalePath := range stalePaths {
+		if changes := module.LocalChanges(stalePath); len(changes) > 0 {
+			protected = append(protected, fmt.Sprintf("%s (%s)", stalePath, strings.Join(changes, ", ")))
+		}
+	}
+	return protected
+}
+
+// resolveModuleFiles computes the MODULE and MODULE.lock files with the resolved hashes, and
+// records the changed hashes in the plan. In --strict mode, it checks that the lock file matches instead.
+func (r *syncResolver) resolveModuleFiles() {
+	r.resolvedModuleFile = r.workspaceModuleFile
+	r.resolvedModuleFile.Dependencies = map[string]module.Dependency{}
+
+	if r.workspaceModuleFile.UseLockFile {
+		r.resolvedLockFile = module.LockFile{Dependencies: map[string]module.LockedDependency{}}
+		for name, hash := range r.pinnedHashes {
+			r.resolvedLockFile.Dependencies[name] = module.LockedDependency{
+				URL:     r.pinnedUrls[name],
+				Version: r.pinnedBy[name].version,
+				Hash:    hash,
+			}
+		}
+		// Keep the previously locked hashes of replaced dependencies.
+		for name := range r.replacements {
+			if locked, isLocked := r.lockFile.Dependencies[name]; isLocked && r.pinnedUrls[name] != "" {
+				r.resolvedLockFile.Dependencies[name] = locked
 			}
+		}
+
+		// Keep only the declarations in the MODULE file.
+		for name, dep := range r.workspaceModuleFile.Dependencies {
+			dep.Hash = ""
+			r.resolvedModuleFile.Dependencies[name] = dep
+		}
 
-			// Check the dependency hash against the fixed hash for that module.
-			if _, isHashPinned := pinnedHashes[name]; !isHashPinned {
-				pinnedHashes[name] = dep.Hash
+		if strict {
+			checkLockFile(r.lockFile, r.resolvedLockFile, r.errorFunc)
+			return
+		}
+
+		for _, entry := range util.OrderedEntries(r.resolvedLockFile.Dependencies) {
+			if oldHash := r.lockFile.Dependencies[entry.Key].Hash; oldHash != entry.Value.Hash {
+				r.plan.PinChanges = append(r.plan.PinChanges, pinChange{entry.Key, util.LockFileName, oldHash, entry.Value.Hash})
 			}
-			pinnedHash := pinnedHashes[name]
-			if dep.Hash != pinnedHash {
-				errorFunc("Dependency requires hash '%s', but hash has been pinned to '%s'.\n", dep.Hash[:7], pinnedHash[:7])
+		}
+		for _, name := range util.OrderedKeys(r.lockFile.Dependencies) {
+			if _, isLocked := r.resolvedLockFile.Dependencies[name]; !isLocked {
+				r.plan.PinChanges = append(r.plan.PinChanges, pinChange{name, util.LockFileName, r.lockFile.Dependencies[name].Hash, ""})
 			}
+		}
+		return
+	}
+
+	// Replaced dependencies keep their previous hash.
+	for _, entry := range util.OrderedEntries(r.workspaceModuleFile.Dependencies) {
+		dep := entry.Value
+		if hash, isPinned := r.pinnedHashes[entry.Key]; isPinned {
+			dep.Hash = hash
+		}
+		r.resolvedModuleFile.Dependencies[entry.Key] = dep
+		if dep.Hash != entry.Value.Hash && !strict {
+			r.plan.PinChanges = append(r.plan.PinChanges, pinChange{entry.Key, util.ModuleFileName, entry.Value.Hash, dep.Hash})
+		}
+	}
+}
 
-			// Check out the pinned hash.
-			if depModule.Head() != pinnedHash {
-				log.Log("Checking out '%s'.\n", pinnedHash[:7])
-				depModule.Checkout(pinnedHash)
-				module.SetupModule(depModulePath)
+// apply brings the workspace into the state described by the plan.
+func (r *syncResolver) apply(plan syncPlan) {
+	// Unpushed commits of all modules are saved to the same branch name.
+	savedBranch := "dbt/saved/" + time.Now().Format("20060102-150405")
+	state := r.syncedState(plan)
+	for _, mod := range plan.Modules {
+		if mod.Replacement != "" {
+			linkReplacement(mod.Path, mod.Replacement)
+			continue
+		}
+		if !mod.Checkout && !mod.Clone && !mod.Setup {
+			continue
+		}
+
+		log.IndentationLevel = 0
+		log.Log("Updating %s\n", mod.Name)
+		log.IndentationLevel = 1
+		if mod.Checkout && mod.Unpushed > 0 {
+			if err := r.modules[mod.Path].(module.GitModule).CreateBranch(savedBranch, "HEAD"); err != nil {
+				log.Fatal("Failed to save unpushed commits to branch '%s': %s.\n", savedBranch, err)
 			}
-			log.Log("\n")
+			log.Warning("Saved %d unpushed commits to branch '%s'.\n", mod.Unpushed, savedBranch)
+		}
+		if mod.Checkout {
+			log.Log("Checking out '%s'.\n", shortHash(mod.Hash))
+			r.modules[mod.Path].Checkout(mod.Hash)
 		}
+		if mod.Setup {
+			module.SetupModule(mod.Path, r.setupPolicy, false)
+		}
+		if (mod.Checkout || mod.Clone) && !syncNoHooks {
+			r.runPostCheckoutHooks(mod, state)
+		}
+		log.Log("\n")
 	}
 
 	log.IndentationLevel = 0
 
-	// Delete everything in the DEPS folder that does not belong there
-	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	// Move everything in the DEPS folder that does not belong there to the trash.
+	for _, stalePath := range plan.Deletions {
+		log.Log("Deleting '%s'\n", stalePath)
+	}
+	if trashDir := module.MoveToTrash(r.workspaceRoot, plan.Deletions); trashDir != "" {
+		log.Log("Deleted modules have been moved to '%s'. Use 'dbt restore-dep' to restore them.\n", trashDir)
+	}
+
+	if strict {
+		return
+	}
+	if r.workspaceModuleFile.UseLockFile {
+		module.WriteLockFile(r.workspaceRoot, r.resolvedLockFile)
+	}
+	module.WriteModuleFile(r.workspaceRoot, r.resolvedModuleFile)
+}
+
+// removeStaleReplacements removes the symlinks in the DEPS/ directory of dependencies that are
+// no longer replaced. In a dry run, they are only recorded.
+func (r *syncResolver) removeStaleReplacements() {
+	depsDir := path.Join(r.workspaceRoot, util.DepsDirName)
 	content, err := ioutil.ReadDir(depsDir)
 	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatal("%v", err)
 	}
 
-	if content != nil {
-		for _, info := range content {
-			fullPath := path.Join(depsDir, info.Name())
-			if !done[fullPath] && fullPath != workspaceModuleSymlink && info.Name() != util.WarningFileName {
-				log.Log("Deleting '%s'\n", fullPath)
-				os.RemoveAll(fullPath)
+	for _, info := range content {
+		fullPath := path.Join(depsDir, info.Name())
+		if (info.Mode()&os.ModeSymlink) != os.ModeSymlink || fullPath == r.workspaceModuleSymlink || module.IsSubdirLink(fullPath) {
+			continue
+		}
+		if _, isReplaced := r.replacements[info.Name()]; isReplaced {
+			continue
+		}
+		if syncDryRun {
+			r.staleReplacements[fullPath] = true
+			continue
+		}
+		log.Log("Removing symlink '%s' of a dependency that is no longer replaced.\n", fullPath)
+		if err := os.Remove(fullPath); err != nil {
+			log.Fatal("Failed to remove symlink '%s': %s.\n", fullPath, err)
+		}
+	}
+}
+
+// expectedHash returns the hash that a dependency is going to be pinned to, or an empty string
+// if it is resolved from the version. New archives are only extracted if they match it.
+func (r *syncResolver) expectedHash(isWorkspaceDependency bool, name string, dep module.Dependency) string {
+	if hash, isPinned := r.pinnedHashes[name]; isPinned {
+		return hash
+	}
+	if isWorkspaceDependency && (update || r.updated[name]) {
+		return ""
+	}
+	if locked, isLocked := r.lockFile.Dependencies[name]; r.workspaceModuleFile.UseLockFile && isLocked && locked.URL == dep.URL {
+		if (isWorkspaceDependency && locked.Version == dep.Version) || dep.Hash == "" {
+			return locked.Hash
+		}
+	}
+	return dep.Hash
+}
+
+// prefetchDependencies clones and fetches the dependencies of all modules in `modulePaths` using
+// a pool of `syncJobs` workers. Modules that have already been fetched or that are replaced by
+// local directories are skipped. In a dry run, missing modules are not cloned.
+func (r *syncResolver) prefetchDependencies(modulePaths []string) {
+	type prefetchJob struct {
+		name string
+		path string
+		dep  module.Dependency
+	}
+
+	jobs := []prefetchJob{}
+	queued := map[string]bool{}
+	for _, modulePath := range modulePaths {
+		if r.done[modulePath] || queued[modulePath] {
+			continue
+		}
+		queued[modulePath] = true
+
+		moduleFile, isKnown := r.readModuleFile(modulePath)
+		if !isKnown {
+			continue
+		}
+		for _, name := range dependencyNames(moduleFile) {
+			depModulePath := path.Join(r.workspaceRoot, util.DepsDirName, name)
+			if _, isReplaced := r.replacements[name]; isReplaced || r.fetched[depModulePath] || queued[depModulePath] {
+				continue
+			}
+			dep := moduleFile.Dependencies[name]
+			if syncDryRun && (!util.DirExists(depModulePath) && !module.IsSubdirLink(depModulePath) || r.staleReplacements[depModulePath]) {
+				continue
 			}
+			// In a dry run, modules are not moved in or out of a subdirectory of a repository.
+			if syncDryRun && !module.SubdirLinkMatches(depModulePath, dep.Subdir) {
+				continue
+			}
+			if module.Offline && !module.IsAvailableOffline(depModulePath, dep.URL, dep.Type) {
+				continue
+			}
+			// The first module requiring a dependency determines its URL, as in the sequential pass.
+			queued[depModulePath] = true
+			dep.Hash = r.expectedHash(modulePath == r.workspaceRoot, name, dep)
+			jobs = append(jobs, prefetchJob{name, depModulePath, dep})
 		}
 	}
 
-	if !strict {
-		// Updated the MODULE file.
-		for name, dep := range workspaceModuleFile.Dependencies {
-			dep.Hash = pinnedHashes[name]
-			workspaceModuleFile.Dependencies[name] = dep
+	if len(jobs) == 0 {
+		return
+	}
+
+	log.IndentationLevel = 0
+	log.Log("Fetching %d modules using %d jobs\n", len(jobs), syncJobs)
+	log.IndentationLevel = 1
+
+	modules := make([]module.Module, len(jobs))
+	created := make([]bool, len(jobs))
+	// With several jobs, each job writes to its own buffered logger, and the
+	// buffers are flushed in job order to keep the output of each module together.
+	loggers := make([]*log.Logger, len(jobs))
+	if syncJobs > 1 {
+		for idx := range loggers {
+			loggers[idx] = log.NewBufferedLogger()
+		}
+	}
+	finished := make([]bool, len(jobs))
+	nextToFlush := 0
+	flushMutex := sync.Mutex{}
+	finish := func(idx int) {
+		flushMutex.Lock()
+		defer flushMutex.Unlock()
+		finished[idx] = true
+		for nextToFlush < len(jobs) && finished[nextToFlush] {
+			loggers[nextToFlush].Flush()
+			nextToFlush++
 		}
-		module.WriteModuleFile(workspaceRoot, workspaceModuleFile)
 	}
 
-	log.Success("Done.\n")
+	// Jobs with the same URL (e.g., several subdirectories of one repository) run one after the other
+	// in the same worker, so that the repository is cloned and fetched only once at a time.
+	groups := [][]int{}
+	groupOfURL := map[string]int{}
+	for idx, job := range jobs {
+		group, ok := groupOfURL[job.dep.URL]
+		if !ok {
+			group = len(groups)
+			groupOfURL[job.dep.URL] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], idx)
+	}
+
+	groupIndices := make(chan []int)
+	wg := sync.WaitGroup{}
+	for worker := 0; worker < syncJobs; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range groupIndices {
+				for _, idx := range group {
+					job := jobs[idx]
+					options := job.dep.CloneOptions()
+					options.Logger = loggers[idx]
+					modules[idx], created[idx] = module.OpenOrCloneModule(job.path, job.dep.URL, job.dep.Type, options)
+					modules[idx].Fetch()
+					loggers[idx].Log("Fetched %s\n", job.name)
+					finish(idx)
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		groupIndices <- group
+	}
+	close(groupIndices)
+	wg.Wait()
+
+	for idx, job := range jobs {
+		r.modules[job.path] = modules[idx]
+		r.fetched[job.path] = true
+		if created[idx] {
+			r.cloned[job.path] = true
+		}
+	}
+	log.Log("\n")
+}
+
+// checkLockFile checks that the lock file contains exactly the pinned dependency hashes.
+func checkLockFile(lockFile, pinnedLockFile module.LockFile, errorFunc func(string, ...interface{})) {
+	for _, entry := range util.OrderedEntries(pinnedLockFile.Dependencies) {
+		locked, isLocked := lockFile.Dependencies[entry.Key]
+		if !isLocked {
+			errorFunc("Dependency '%s' is missing from %s.\n", entry.Key, util.LockFileName)
+		} else if locked.Hash != entry.Value.Hash {
+			errorFunc("%s pins dependency '%s' to hash '%s', but it resolves to hash '%s'.\n", util.LockFileName, entry.Key, locked.Hash, entry.Value.Hash)
+		}
+	}
+	for _, name := range util.OrderedKeys(lockFile.Dependencies) {
+		if _, isPinned := pinnedLockFile.Dependencies[name]; !isPinned {
+			errorFunc("%s contains dependency '%s', which is not required by any module.\n", util.LockFileName, name)
+		}
+	}
+}
+
+// versionRequirement is a version string that a module requires for one of its dependencies.
+type versionRequirement struct {
+	module  string
+	version string
+}
+
+// resolveVersionRef returns the git reference that a dependency version string refers to.
+// Version constraints (e.g., '^1.4') refer to the highest tag satisfying them.
+func resolveVersionRef(depModule module.Module, version string) string {
+	if !util.IsVersionConstraint(version) {
+		return version
+	}
+
+	constraint := parseVersionConstraint(version)
+	tag, ok := util.HighestMatchingVersion(util.OrderedKeys(depModule.Tags()), constraint)
+	if !ok {
+		log.Fatal("No tag of module '%s' satisfies version '%s'.\n", depModule.Name(), version)
+	}
+	log.Debug("Version '%s' resolves to tag '%s'.\n", version, tag)
+	return tag
+}
+
+// matchingTagForHash returns the highest tag pointing at `hash` that satisfies the version constraint.
+func matchingTagForHash(depModule module.Module, hash string, version string) (string, bool) {
+	tags := []string{}
+	for tag, tagHash := range depModule.Tags() {
+		if tagHash == hash {
+			tags = append(tags, tag)
+		}
+	}
+	return util.HighestMatchingVersion(tags, parseVersionConstraint(version))
+}
+
+// checkPinnedVersion checks that the hash pinned because of `pinned` satisfies the version range
+// `required`, and reports both requirements as conflicting otherwise.
+func checkPinnedVersion(depModule module.Module, pinnedHash string, pinned, required versionRequirement, errorFunc func(string, ...interface{})) {
+	if tag, ok := matchingTagForHash(depModule, pinnedHash, required.version); ok {
+		log.Log("Pinned hash '%s' (tag '%s') satisfies version '%s'.\n", pinnedHash[:7], tag, required.version)
+		return
+	}
+
+	conflict := fmt.Sprintf("Conflicting versions for dependency '%s': module '%s' requires '%s', but module '%s' requires '%s' and pinned hash '%s'.",
+		depModule.Name(), required.module, required.version, pinned.module, pinned.version, pinnedHash[:7])
+	if util.IsVersionConstraint(pinned.version) {
+		constraints := []util.VersionConstraint{parseVersionConstraint(pinned.version), parseVersionConstraint(required.version)}
+		if tag, ok := util.HighestMatchingVersion(util.OrderedKeys(depModule.Tags()), constraints...); ok {
+			conflict += fmt.Sprintf(" Tag '%s' satisfies both versions, consider updating the hash in module '%s'.", tag, pinned.module)
+		} else {
+			conflict += " No tag satisfies both versions."
+		}
+	}
+	errorFunc("%s\n", conflict)
+}
+
+func parseVersionConstraint(version string) util.VersionConstraint {
+	constraint, err := util.ParseVersionConstraint(version)
+	if err != nil {
+		log.Fatal("Invalid version constraint: %s.\n", err)
+	}
+	return constraint
+}
+
+// linkReplacement symlinks the local directory `replacement` to `depModulePath`.
+func linkReplacement(depModulePath, replacement string) {
+	info, err := os.Lstat(depModulePath)
+	if err == nil {
+		if (info.Mode() & os.ModeSymlink) != os.ModeSymlink {
+			log.Fatal("'%s' is a checked out module. Remove it to replace it with a local directory.\n", depModulePath)
+		}
+		if target, _ := os.Readlink(depModulePath); target == replacement {
+			return
+		}
+		if err := os.Remove(depModulePath); err != nil {
+			log.Fatal("Failed to remove symlink '%s': %s.\n", depModulePath, err)
+		}
+	}
+
+	log.Debug("Creating symlink '%s' -> '%s'.\n", depModulePath, replacement)
+	if err := os.Symlink(replacement, depModulePath); err != nil {
+		log.Fatal("Failed to create symlink for replaced dependency: %s.\n", err)
+	}
 }
 
 func dependencyNames(file module.ModuleFile) []string {
@@ -219,7 +1039,7 @@ func dependencyNames(file module.ModuleFile) []string {
 	for name, dep := range file.Dependencies {
 		modType := module.DetermineModuleType(dep.URL, dep.Type)
 
-		if modType == module.GitModuleType {
+		if modType == module.GitModuleType && dep.Subdir == "" {
 			// Ensure that the dependency name matches the name of the git repo, since otherwise `module.Name()`
 			// is broken.
 			expectedName := strings.TrimSuffix(path.Base(dep.URL), ".git")
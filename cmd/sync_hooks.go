@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"path"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/module"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// hookState is the JSON description of the workspace that hooks receive on stdin.
+type hookState struct {
+	Hook      string
+	Workspace string
+	// Module is the module that declares the hook.
+	Module string
+	// Modules maps the names of all modules in the workspace to their hashes: the checked out
+	// hashes before the sync, and the pinned hashes afterwards.
+	Modules map[string]string
+	// Plan lists the changes that the sync makes to the workspace. It is not set for pre-sync hooks.
+	Plan *syncPlan `json:",omitempty"`
+}
+
+func runHooks(event, name, modulePath string, hooks []module.Hook, state hookState, policy module.SetupPolicy) {
+	if len(hooks) == 0 {
+		return
+	}
+
+	state.Hook = event
+	state.Module = name
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Fatal("Failed to encode the state of the workspace for the %s hooks: %s.\n", event, err)
+	}
+	for _, hook := range hooks {
+		module.RunHook(name, modulePath, event, hook, data, policy)
+	}
+}
+
+// runPreSyncHooks runs the pre-sync hooks of the top-level module.
+func runPreSyncHooks(workspaceRoot, workspaceModuleName string, workspaceModuleFile module.ModuleFile, policy module.SetupPolicy) {
+	hooks := workspaceModuleFile.Hooks.PreSync
+	if len(hooks) == 0 {
+		return
+	}
+
+	state := hookState{Workspace: workspaceRoot, Modules: map[string]string{}}
+	if util.DirExists(path.Join(workspaceRoot, util.DepsDirName)) {
+		modules := module.GetAllModules(workspaceRoot)
+		for _, entry := range modules.Entries() {
+			if entry.Key != workspaceModuleName {
+				state.Modules[entry.Key] = entry.Value.Head()
+			}
+		}
+	}
+	runHooks(module.PreSyncHook, workspaceModuleName, workspaceRoot, hooks, state, policy)
+}
+
+// syncedState describes the workspace once all modules are checked out according to the plan.
+func (r *syncResolver) syncedState(plan syncPlan) hookState {
+	state := hookState{Workspace: r.workspaceRoot, Modules: map[string]string{}, Plan: &plan}
+	for _, mod := range plan.Modules {
+		if mod.Replacement == "" {
+			state.Modules[mod.Name] = mod.Hash
+		}
+	}
+	return state
+}
+
+// runPostCheckoutHooks runs the post-checkout hooks of a module that has been cloned or checked out.
+func (r *syncResolver) runPostCheckoutHooks(mod plannedModule, state hookState) {
+	if !r.setupPolicy.IsAllowed(mod.Name) {
+		return
+	}
+	hooks := module.ReadModuleFile(mod.Path).Hooks.PostCheckout
+	runHooks(module.PostCheckoutHook, mod.Name, mod.Path, hooks, state, r.setupPolicy)
+}
+
+// runPostSyncHooks runs the post-sync hooks of all dependencies, and those of the top-level module last.
+func (r *syncResolver) runPostSyncHooks(workspaceModuleName string, plan syncPlan) {
+	state := r.syncedState(plan)
+	for _, mod := range plan.Modules {
+		if !r.setupPolicy.IsAllowed(mod.Name) {
+			continue
+		}
+		hooks := module.ReadModuleFile(mod.Path).Hooks.PostSync
+		runHooks(module.PostSyncHook, mod.Name, mod.Path, hooks, state, r.setupPolicy)
+	}
+	runHooks(module.PostSyncHook, workspaceModuleName, r.workspaceRoot, r.workspaceModuleFile.Hooks.PostSync, state, r.setupPolicy)
+}
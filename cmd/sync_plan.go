@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/daedaleanai/dbt/v3/log"
+)
+
+// plannedModule describes what sync does to a single dependency.
+type plannedModule struct {
+	Name    string
+	Path    string
+	URL     string
+	Type    string `json:",omitempty"`
+	Version string
+	// Head is the current commit of the module, or empty if it has not been cloned.
+	Head string `json:",omitempty"`
+	// Hash is the pinned commit of the module.
+	Hash        string `json:",omitempty"`
+	Clone       bool
+	Checkout    bool
+	Setup       bool
+	Replacement string `json:",omitempty"`
+	// Unresolved is set for modules that have not been cloned in a dry run. Neither their hash
+	// nor their dependencies are known yet.
+	Unresolved bool `json:",omitempty"`
+	// Unpushed is the number of commits reachable from the current HEAD that are not on any remote
+	// branch. Checking out the module detaches them.
+	Unpushed int `json:",omitempty"`
+}
+
+// pinChange is a dependency hash that changes in the MODULE or MODULE.lock file.
+type pinChange struct {
+	Name    string
+	File    string
+	OldHash string
+	NewHash string
+}
+
+// syncPlan lists all changes that sync makes to the workspace.
+type syncPlan struct {
+	Modules    []plannedModule
+	Deletions  []string
+	PinChanges []pinChange
+}
+
+func shortHash(hash string) string {
+	if len(hash) < 7 {
+		return hash
+	}
+	return hash[:7]
+}
+
+func printSyncPlan(plan syncPlan, format string) {
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(plan); err != nil {
+			log.Fatal("Failed to encode sync plan: %s.\n", err)
+		}
+		return
+	}
+
+	fmt.Println("Sync plan:")
+	changes := 0
+	for _, mod := range plan.Modules {
+		switch {
+		case mod.Replacement != "":
+			fmt.Printf("  link      %s -> %s\n", mod.Name, mod.Replacement)
+		case mod.Clone && mod.Unresolved:
+			fmt.Printf("  clone     %s from %s (version '%s', dependencies unknown)\n", mod.Name, mod.URL, mod.Version)
+		case mod.Clone:
+			fmt.Printf("  clone     %s at %s\n", mod.Name, shortHash(mod.Hash))
+		case mod.Checkout && mod.Unpushed > 0:
+			fmt.Printf("  checkout  %s %s -> %s (detaches %d unpushed commits)\n", mod.Name, shortHash(mod.Head), shortHash(mod.Hash), mod.Unpushed)
+		case mod.Checkout:
+			fmt.Printf("  checkout  %s %s -> %s\n", mod.Name, shortHash(mod.Head), shortHash(mod.Hash))
+		default:
+			continue
+		}
+		changes++
+		if mod.Setup {
+			fmt.Printf("  setup     %s (runs SETUP.go)\n", mod.Name)
+		}
+	}
+	for _, change := range plan.PinChanges {
+		oldHash, newHash := shortHash(change.OldHash), shortHash(change.NewHash)
+		if oldHash == "" {
+			oldHash = "<none>"
+		}
+		if newHash == "" {
+			newHash = "<none>"
+		}
+		fmt.Printf("  pin       %s %s -> %s in %s\n", change.Name, oldHash, newHash, change.File)
+		changes++
+	}
+	for _, stalePath := range plan.Deletions {
+		fmt.Printf("  delete    %s\n", stalePath)
+		changes++
+	}
+	if changes == 0 {
+		fmt.Println("  Workspace is up to date.")
+	}
+}
@@ -3,9 +3,11 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/daedaleanai/dbt/v3/log"
 	"gopkg.in/yaml.v2"
@@ -14,10 +16,68 @@ import (
 type Config struct {
 	Mirror       string
 	PersistFlags bool `yaml:"persist-flags"`
+	// Replace maps dependency names to local directories that are used instead of the dependency.
+	Replace map[string]string
+	// Setup restricts the execution of SETUP.go scripts.
+	Setup SetupPolicy
+	// HTTP configures the downloads of archives.
+	HTTP HTTPConfig `yaml:"http"`
+	// Credentials authenticate the downloads of archives. Hosts without credentials use the netrc file.
+	Credentials []Credential
+}
+
+// Credential authenticates the downloads of all archives whose URL starts with Prefix. The token is read
+// from Token, the environment variable TokenEnv or the output of TokenCommand.
+type Credential struct {
+	Prefix string
+	// Type is the auth scheme: "basic" (the token is the password), "bearer" or "header".
+	Type string
+	// User is the user name for basic auth.
+	User string `yaml:",omitempty"`
+	// Header is the name of the header that holds the token for the "header" type.
+	Header       string   `yaml:",omitempty"`
+	Token        string   `yaml:",omitempty"`
+	TokenEnv     string   `yaml:"token-env,omitempty"`
+	TokenCommand []string `yaml:"token-command,omitempty"`
+}
+
+// HTTPConfig configures the timeouts and retries of archive downloads.
+type HTTPConfig struct {
+	// Timeout is the time limit for connecting to a server and receiving the response headers (e.g., "30s").
+	Timeout string `yaml:",omitempty"`
+	// IdleTimeout is the time limit for receiving more data while downloading. The download is retried afterwards.
+	IdleTimeout string `yaml:"idle-timeout,omitempty"`
+	// Retries is the number of times that a failed download is retried.
+	Retries *int `yaml:",omitempty"`
+	// RetryDelay is the delay before the first retry. It doubles with every retry.
+	RetryDelay string `yaml:"retry-delay,omitempty"`
+	// HTTPProxy and HTTPSProxy are the proxies for http and https URLs. They override the http_proxy
+	// and https_proxy environment variables.
+	HTTPProxy  string `yaml:"http-proxy,omitempty"`
+	HTTPSProxy string `yaml:"https-proxy,omitempty"`
+	// NoProxy lists the hosts, domains and IP ranges that are accessed without a proxy, separated by
+	// commas. It overrides the no_proxy environment variable.
+	NoProxy string `yaml:"no-proxy,omitempty"`
+	// CABundles lists PEM files with CA certificates that are trusted in addition to the system's.
+	CABundles []string `yaml:"ca-bundles,omitempty"`
+}
+
+// SetupPolicy restricts which SETUP.go scripts run, for how long and with which environment.
+// It can be set in the user configuration and in the top-level MODULE file.
+type SetupPolicy struct {
+	// Timeout is the time limit of SETUP.go scripts (e.g., "30s").
+	Timeout string `yaml:",omitempty"`
+	// Timeouts overrides the time limit for individual modules.
+	Timeouts map[string]string `yaml:",omitempty"`
+	// Allow lists the modules that may run their SETUP.go script and hooks. All modules may run them if it is empty.
+	Allow []string `yaml:",omitempty"`
+	// Env lists environment variables that are passed to SETUP.go scripts and hooks in addition to the defaults.
+	Env []string `yaml:",omitempty"`
 }
 
 var environment map[string]string
-var config *Config
+var config Config
+var configOnce sync.Once
 
 const configFileName string = "config.yaml"
 
@@ -71,16 +131,48 @@ func loadConfiguration() Config {
 		return config
 	}
 
+	// Relative paths do not depend on the directory dbt runs in.
+	for name, dir := range config.Replace {
+		if !path.IsAbs(dir) {
+			config.Replace[name] = path.Join(configDir, dir)
+		}
+	}
+
 	log.Debug("Loaded configuration from `%s`\n", configFilePath)
-	log.Debug("Running with configuration: %+v\n", config)
+	log.Debug("Running with configuration: %+v\n", redactCredentials(config))
 	return config
 }
 
-func GetConfig() Config {
-	if config == nil {
-		loadedConfig := loadConfiguration()
-		config = &loadedConfig
+// redactUserInfo removes the user name and password from a proxy URL.
+func redactUserInfo(proxy string) string {
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil || proxyUrl.User == nil {
+		return proxy
 	}
+	proxyUrl.User = url.User("<redacted>")
+	return proxyUrl.String()
+}
 
-	return *config
+// redactCredentials returns the configuration without the tokens of credentials and proxies, so that it can be logged.
+func redactCredentials(config Config) Config {
+	credentials := []Credential{}
+	for _, credential := range config.Credentials {
+		if credential.Token != "" {
+			credential.Token = "<redacted>"
+		}
+		credentials = append(credentials, credential)
+	}
+	config.Credentials = credentials
+	config.HTTP.HTTPProxy = redactUserInfo(config.HTTP.HTTPProxy)
+	config.HTTP.HTTPSProxy = redactUserInfo(config.HTTP.HTTPSProxy)
+	return config
+}
+
+func GetConfig() Config {
+	// Modules may be opened from several goroutines at once, so the configuration is loaded exactly once.
+	configOnce.Do(func() {
+		config = loadConfiguration()
+	})
+
+	return config
 }
@@ -26,7 +26,7 @@
             pname = "dbt-app";
             version = "v3.1.0-dev";
             src = ./.;
-            vendorHash = "sha256-y0AHBjCnZv2c7r/NXFrJd2dtkX1fMQzRbOmqnw7J4DM=";
+            vendorHash = "sha256-zmp/+TkRPFWcP+0SiV2GGbSMiLHehLa+C+jQ8pgIGsc=";
             tags = [
               "semver-override=${version}"
             ];
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 )
 
 // Verbose controls whether debug messages are being printed.
@@ -21,6 +22,9 @@ var IndentationLevel = 0
 
 var errorOccured = false
 
+// outputMutex serializes writes so that messages logged from concurrent goroutines do not interleave.
+var outputMutex sync.Mutex
+
 type Color uint
 
 const (
@@ -63,37 +67,136 @@ func ErrorOccured() bool {
 	return errorOccured
 }
 
+// Logger holds back the messages of a job that runs concurrently with other jobs, so that the
+// output of the jobs does not interleave. A nil *Logger prints messages right away, like the
+// package-level functions.
+type Logger struct {
+	// buffer holds the messages until Flush() is called. Guarded by outputMutex.
+	buffer *strings.Builder
+}
+
+// NewBufferedLogger returns a Logger that holds back all messages until Flush() is called.
+func NewBufferedLogger() *Logger {
+	return &Logger{buffer: &strings.Builder{}}
+}
+
+// write prints a message to os.Stderr, or appends it to the buffer of the logger.
+// outputMutex must be held.
+func (l *Logger) write(message string) {
+	if l != nil && l.buffer != nil {
+		l.buffer.WriteString(message)
+		return
+	}
+	fmt.Fprint(os.Stderr, message)
+}
+
+// Flush prints all messages that have been held back. Later messages are printed right away.
+func (l *Logger) Flush() {
+	if l == nil {
+		return
+	}
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if l.buffer != nil {
+		fmt.Fprint(os.Stderr, l.buffer.String())
+		l.buffer = nil
+	}
+}
+
 // Log prints an indented and formatted message to os.Stdout.
-func Log(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+format, a...)
+func (l *Logger) Log(format string, a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	l.write(fmt.Sprintf(strings.Repeat("  ", IndentationLevel)+format, a...))
 }
 
 // Debug prints an indented and formatted debug message to os.Stdout if verbose output is selected.
-func Debug(format string, a ...interface{}) {
+func (l *Logger) Debug(format string, a ...interface{}) {
 	if Verbose {
-		fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorBlue)+"Debug: "+GetColorString(ColorReset)+format, a...)
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
+		l.write(fmt.Sprintf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorBlue)+"Debug: "+GetColorString(ColorReset)+format, a...))
+	}
+}
+
+// Progress overwrites the current line of the terminal with an indented and formatted message
+// without a line break. Progress("") clears the line. Progress is not shown while messages are held back.
+func (l *Logger) Progress(format string, a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if l != nil && l.buffer != nil {
+		return
+	}
+	if format == "" {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		return
 	}
+	fmt.Fprintf(os.Stderr, "\r\033[K"+strings.Repeat("  ", IndentationLevel)+format, a...)
+}
+
+// Success prints an indented and formatted success message to os.Stdout.
+func (l *Logger) Success(format string, a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	l.write(fmt.Sprintf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorGreen)+"Success: "+GetColorString(ColorReset)+format, a...))
+}
+
+// Warning prints an indented and formatted warning to os.Stdout.
+func (l *Logger) Warning(format string, a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	l.write(fmt.Sprintf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorYellow)+"Warning: "+GetColorString(ColorReset)+format, a...))
+}
+
+// Error prints an indented and formatted error message to os.Stdout.
+func (l *Logger) Error(format string, a ...interface{}) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	errorOccured = true
+	l.write(fmt.Sprintf(strings.Repeat("  ", IndentationLevel)+GetColorString(ColorRed)+"Error: "+GetColorString(ColorReset)+format, a...))
+}
+
+// Fatal prints all messages that have been held back and an indented and formatted error message
+// to os.Stdout, and terminates the program.
+func (l *Logger) Fatal(format string, a ...interface{}) {
+	l.Error(format, a...)
+	l.Flush()
+	fmt.Fprintf(os.Stderr, GetColorString(ColorRed)+"A fatal error occured. Exiting..."+GetColorString(ColorReset)+"\n")
+	os.Exit(1)
+}
+
+// Log prints an indented and formatted message to os.Stdout.
+func Log(format string, a ...interface{}) {
+	(*Logger)(nil).Log(format, a...)
+}
+
+// Debug prints an indented and formatted debug message to os.Stdout if verbose output is selected.
+func Debug(format string, a ...interface{}) {
+	(*Logger)(nil).Debug(format, a...)
+}
+
+// Progress overwrites the current line of the terminal with an indented and formatted message
+// without a line break. Progress("") clears the line.
+func Progress(format string, a ...interface{}) {
+	(*Logger)(nil).Progress(format, a...)
 }
 
 // Success prints an indented and formatted success message to os.Stdout.
 func Success(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorGreen)+"Success: "+GetColorString(ColorReset)+format, a...)
+	(*Logger)(nil).Success(format, a...)
 }
 
 // Warning prints an indented and formatted warning to os.Stdout.
 func Warning(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorYellow)+"Warning: "+GetColorString(ColorReset)+format, a...)
+	(*Logger)(nil).Warning(format, a...)
 }
 
 // Error prints an indented and formatted error message to os.Stdout.
 func Error(format string, a ...interface{}) {
-	errorOccured = true
-	fmt.Fprintf(os.Stderr, strings.Repeat("  ", IndentationLevel)+GetColorString(ColorRed)+"Error: "+GetColorString(ColorReset)+format, a...)
+	(*Logger)(nil).Error(format, a...)
 }
 
 // Fatal prints an indented and formatted error message to os.Stdout and terminates the program.
 func Fatal(format string, a ...interface{}) {
-	Error(format, a...)
-	fmt.Fprintf(os.Stderr, GetColorString(ColorRed)+"A fatal error occured. Exiting..."+GetColorString(ColorReset)+"\n")
-	os.Exit(1)
+	(*Logger)(nil).Fatal(format, a...)
 }
@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/module"
@@ -11,6 +12,8 @@ import (
 type Module struct {
 	Name, Url, Hash, Type string
 	Dirty                 bool
+	// Replaced is set for modules that are replaced by local directories.
+	Replaced bool `yaml:",omitempty"`
 }
 
 type DbtVersion struct {
@@ -51,7 +54,9 @@ func (c Commit) String() string {
 	return fmt.Sprintf("%s: %s - %s", c.Id[:7], c.Title, c.AuthorName)
 }
 
-func Generate(modules util.OrderedMap[string, module.Module], allowUncommittedChanges bool) (Manifest, error) {
+// Generate creates a manifest of the given modules. Modules are marked as replaced if their name
+// is a key of `replacements`.
+func Generate(modules util.OrderedMap[string, module.Module], replacements map[string]string, allowUncommittedChanges bool) (Manifest, error) {
 	dbtVersion := util.VersionTriplet()
 	manifest := Manifest{
 		DbtVersion: DbtVersion{
@@ -61,7 +66,18 @@ func Generate(modules util.OrderedMap[string, module.Module], allowUncommittedCh
 		},
 	}
 
-	for _, mod := range modules.Values() {
+	for _, entry := range modules.Entries() {
+		mod := entry.Value
+		// Only modules that are actually symlinked to the local directory are replaced.
+		replacement, replaced := replacements[entry.Key]
+		if replaced {
+			target, err := os.Readlink(mod.RootPath())
+			replaced = err == nil && target == replacement
+		}
+		if replaced {
+			log.Warning("Module %q is replaced by local directory %q\n", entry.Key, replacement)
+		}
+
 		dirty := mod.IsDirty()
 		if dirty {
 			message := fmt.Sprintf("Module %q has uncommitted changes", mod.Name())
@@ -73,17 +89,28 @@ func Generate(modules util.OrderedMap[string, module.Module], allowUncommittedCh
 		}
 
 		manifest.Modules = append(manifest.Modules, Module{
-			Name:  mod.Name(),
-			Url:   mod.URL(),
-			Hash:  mod.Head(),
-			Type:  mod.Type().String(),
-			Dirty: dirty,
+			Name:     mod.Name(),
+			Url:      mod.URL(),
+			Hash:     mod.Head(),
+			Type:     mod.Type().String(),
+			Dirty:    dirty,
+			Replaced: replaced,
 		})
 	}
 
 	return manifest, nil
 }
 
+// CheckLockFile checks that all modules in the manifest are at the hashes pinned in the lock file.
+func CheckLockFile(manifest Manifest, lockFile module.LockFile) error {
+	for _, mod := range manifest.Modules {
+		if locked, ok := lockFile.Dependencies[mod.Name]; ok && !mod.Replaced && locked.Hash != mod.Hash {
+			return fmt.Errorf("Module %q is at hash %q, but %s pins hash %q. Run 'dbt sync' first", mod.Name, mod.Hash, util.LockFileName, locked.Hash)
+		}
+	}
+	return nil
+}
+
 func parseCommitFromRef(gitMod module.GitModule, ref string) (Commit, error) {
 	result := Commit{Id: ref}
 	var err error
@@ -0,0 +1,500 @@
+package module
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const defaultFileMode = 0660
+
+// maxSymlinkHops limits the number of symlinks followed when resolving a path.
+const maxSymlinkHops = 255
+
+// AllowedSymlinkTargets lists paths outside of the module directory that symlinks in archives may
+// point to. Symlinks to any other path outside of the module directory are rejected.
+var AllowedSymlinkTargets []string
+
+type archiveFormat int
+
+const (
+	tarFormat archiveFormat = iota
+	tarGzFormat
+	tarXzFormat
+	tarZstdFormat
+	tarBzip2Format
+	zipFormat
+)
+
+// archiveSuffixes maps the file extensions of archives to their format.
+var archiveSuffixes = []struct {
+	suffix string
+	format archiveFormat
+}{
+	{".tar.gz", tarGzFormat},
+	{".tgz", tarGzFormat},
+	{".tar.xz", tarXzFormat},
+	{".txz", tarXzFormat},
+	{".tar.zst", tarZstdFormat},
+	{".tar.bz2", tarBzip2Format},
+	{".tbz2", tarBzip2Format},
+	{".zip", zipFormat},
+	{".tar", tarFormat},
+}
+
+// archiveMagics maps the magic bytes at the start of compressed archives to their format.
+var archiveMagics = []struct {
+	magic  []byte
+	format archiveFormat
+}{
+	{[]byte{0x1f, 0x8b}, tarGzFormat},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, tarXzFormat},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, tarZstdFormat},
+	{[]byte("BZh"), tarBzip2Format},
+	{[]byte("PK\x03\x04"), zipFormat},
+	{[]byte("PK\x05\x06"), zipFormat},
+}
+
+func urlPath(url string) string {
+	if parsed, err := neturl.Parse(url); err == nil && parsed.Path != "" {
+		return parsed.Path
+	}
+	return url
+}
+
+// IsArchiveUrl reports whether `url` has the file extension of a supported archive format.
+func IsArchiveUrl(url string) bool {
+	_, ok := archiveFormatFromUrl(url)
+	return ok
+}
+
+func archiveFormatFromUrl(url string) (archiveFormat, bool) {
+	for _, entry := range archiveSuffixes {
+		if strings.HasSuffix(urlPath(url), entry.suffix) {
+			return entry.format, true
+		}
+	}
+	return tarFormat, false
+}
+
+// detectArchiveFormat determines the format of an archive from its first bytes, or from the
+// file extension in `url` if the bytes are not known.
+func detectArchiveFormat(url string, header []byte) (archiveFormat, error) {
+	for _, entry := range archiveMagics {
+		if bytes.HasPrefix(header, entry.magic) {
+			return entry.format, nil
+		}
+	}
+	// Uncompressed tar archives have a magic string in the header of the first file.
+	if len(header) >= 262 && string(header[257:262]) == "ustar" {
+		return tarFormat, nil
+	}
+	if format, ok := archiveFormatFromUrl(url); ok {
+		return format, nil
+	}
+	return tarFormat, fmt.Errorf("unknown archive format")
+}
+
+// extract extracts the archive downloaded from `url` into the module directory.
+func (m TarModule) extract(url string, archive *os.File) error {
+	header := make([]byte, 512)
+	n, err := archive.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read archive: %s", err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read archive: %s", err)
+	}
+
+	format, err := detectArchiveFormat(url, header[:n])
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.path, defaultDirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	root, err := resolvePath(m.path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve module path: %s", err)
+	}
+	extractor := &archiveExtractor{path: m.path, root: root, allowedTargets: AllowedSymlinkTargets}
+
+	var reader io.Reader
+	switch format {
+	case zipFormat:
+		info, err := archive.Stat()
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %s", err)
+		}
+		return extractor.extractZip(archive, info.Size())
+	case tarGzFormat:
+		gzReader, err := gzip.NewReader(archive)
+		if err != nil {
+			return fmt.Errorf("failed to decompress: %s", err)
+		}
+		reader = gzReader
+	case tarXzFormat:
+		xzReader, err := xz.NewReader(archive)
+		if err != nil {
+			return fmt.Errorf("failed to decompress: %s", err)
+		}
+		reader = xzReader
+	case tarZstdFormat:
+		zstdReader, err := zstd.NewReader(archive)
+		if err != nil {
+			return fmt.Errorf("failed to decompress: %s", err)
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	case tarBzip2Format:
+		reader = bzip2.NewReader(archive)
+	default:
+		reader = archive
+	}
+	return extractor.extractTar(tar.NewReader(reader))
+}
+
+// archiveExtractor extracts the entries of an archive into a module directory. No entry may be
+// written outside of the module directory, neither directly nor through symlinks, and symlinks may
+// only point outside of the module directory if their target is allowed.
+type archiveExtractor struct {
+	// path is the module directory.
+	path string
+	// root is the module directory with all symlinks resolved.
+	root string
+	// rootDir is the top-level directory of the archive.
+	rootDir        string
+	allowedTargets []string
+	symlinks       []string
+}
+
+// resolvePath returns the absolute path that `p` refers to once all symlinks in it are followed.
+// Unlike filepath.EvalSymlinks, `p` does not need to exist, and '..' is applied after following
+// the symlink that precedes it.
+func resolvePath(p string) (string, error) {
+	if !path.IsAbs(p) {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		p = workingDir + "/" + p
+	}
+
+	resolved := "/"
+	components := strings.Split(p, "/")
+	for hops := 0; len(components) > 0; {
+		component := components[0]
+		components = components[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, component)
+		info, err := os.Lstat(next)
+		if err != nil || (info.Mode()&os.ModeSymlink) != os.ModeSymlink {
+			resolved = next
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return "", fmt.Errorf("too many levels of symbolic links in '%s'", p)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		components = append(strings.Split(target, "/"), components...)
+	}
+	return resolved, nil
+}
+
+func isInDir(dir, p string) bool {
+	relPath, err := filepath.Rel(dir, p)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, "../")
+}
+
+// entryPath returns the path that the archive entry `name` is extracted to, with all symlinks resolved.
+// It fails if the entry leaves the module directory.
+func (e *archiveExtractor) entryPath(name string) (string, error) {
+	// The path is joined without cleaning it, so that '..' is resolved after symlinks.
+	entryPath := e.path + "/" + strings.TrimPrefix(stripRoot(name), "/")
+	resolved, err := resolvePath(entryPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress: %s", err)
+	}
+	if !isInDir(e.root, resolved) {
+		return "", fmt.Errorf("failed to decompress: archive entry '%s' leaves the module directory", name)
+	}
+	return resolved, nil
+}
+
+// fileEntryPath is like entryPath, but for entries that replace existing symlinks instead of writing
+// to their target.
+func (e *archiveExtractor) fileEntryPath(name string) (string, error) {
+	parentPath, err := e.entryPath(path.Dir(name))
+	if err != nil {
+		return "", err
+	}
+	entryPath := path.Join(parentPath, path.Base(name))
+	if info, err := os.Lstat(entryPath); err == nil && (info.Mode()&os.ModeSymlink) == os.ModeSymlink {
+		if err := os.Remove(entryPath); err != nil {
+			return "", fmt.Errorf("failed to remove symlink: %s", err)
+		}
+	}
+	return e.entryPath(name)
+}
+
+// checkSymlink fails if the symlink at `linkPath` points outside of the module directory, unless its
+// target is allowed.
+func (e *archiveExtractor) checkSymlink(linkPath string) error {
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		return fmt.Errorf("failed to read symlink: %s", err)
+	}
+	resolved, err := resolvePath(linkPath)
+	if err != nil {
+		return fmt.Errorf("failed to decompress: %s", err)
+	}
+	if isInDir(e.root, resolved) {
+		return nil
+	}
+	for _, allowedTarget := range e.allowedTargets {
+		if isInDir(path.Clean(allowedTarget), resolved) {
+			log.Debug("Symlink '%s' points to allowed target '%s'.\n", linkPath, resolved)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to decompress: symlink '%s' to '%s' points outside of the module directory. "+
+		"Use 'dbt sync --allow-symlink=%s' if the target is safe", linkPath, target, resolved)
+}
+
+// checkSymlinks checks all symlinks again once the archive is extracted, since symlinks that are
+// extracted later can change the target of earlier ones.
+func (e *archiveExtractor) checkSymlinks() error {
+	for _, linkPath := range e.symlinks {
+		// The symlink might have been replaced by a later entry.
+		if info, err := os.Lstat(linkPath); err != nil || (info.Mode()&os.ModeSymlink) != os.ModeSymlink {
+			continue
+		}
+		if err := e.checkSymlink(linkPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkArchiveRoot checks that all entries of an archive are in the same root directory.
+func (e *archiveExtractor) checkArchiveRoot(name string, isDir bool) error {
+	entryRootDir := getRoot(name)
+	if !isDir && entryRootDir == name {
+		return fmt.Errorf("failed to decompress: archive can't have files outside root directory")
+	}
+	if e.rootDir == "" {
+		e.rootDir = entryRootDir
+	} else if e.rootDir != entryRootDir {
+		return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
+	}
+	return nil
+}
+
+func (e *archiveExtractor) extractTar(tarReader *tar.Reader) error {
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decompress: %s", err)
+		}
+
+		if err := e.checkArchiveRoot(header.Name, header.Typeflag == tar.TypeDir); err != nil {
+			return err
+		}
+
+		// We can't assume that tarReader visits a dir before the files inside it, although this is true most of the time.
+		// So if we find a file whose dir hasn't been created yet, we make it, with a sensible default access mode
+		// When we eventually visit it, we set the correct mode
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := e.createDir(header.Name, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := e.writeFile(header.Name, tarReader, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if getRoot(header.Linkname) != e.rootDir {
+				return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
+			}
+			oldname, err := e.entryPath(header.Linkname)
+			if err != nil {
+				return err
+			}
+			newname, err := e.fileEntryPath(header.Name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(path.Dir(newname), defaultDirMode); err != nil {
+				return fmt.Errorf("failed to create directory: %s", err)
+			}
+			log.Debug("Creating link from '%s' to '%s'.\n", newname, oldname)
+			if err = os.Link(oldname, newname); err != nil {
+				return fmt.Errorf("failed to create link: %s", err)
+			}
+		case tar.TypeSymlink:
+			if err := e.createSymlink(header.Name, header.Linkname); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown tar type flag %d for entry '%s'", header.Typeflag, header.Name)
+		}
+	}
+	return e.checkSymlinks()
+}
+
+func (e *archiveExtractor) extractZip(archive io.ReaderAt, size int64) error {
+	zipReader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return fmt.Errorf("failed to decompress: %s", err)
+	}
+
+	for _, file := range zipReader.File {
+		name := strings.TrimSuffix(file.Name, "/")
+		mode := file.Mode()
+		if err := e.checkArchiveRoot(name, mode.IsDir()); err != nil {
+			return err
+		}
+
+		switch {
+		case mode.IsDir():
+			dirMode := mode.Perm()
+			if dirMode == 0 {
+				dirMode = defaultDirMode
+			}
+			if err := e.createDir(name, dirMode); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			target, err := readZipFile(file)
+			if err != nil {
+				return err
+			}
+			if err := e.createSymlink(name, string(target)); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			reader, err := file.Open()
+			if err != nil {
+				return fmt.Errorf("failed to decompress: %s", err)
+			}
+			fileMode := mode.Perm()
+			if fileMode == 0 {
+				fileMode = defaultFileMode
+			}
+			err = e.writeFile(name, reader, fileMode)
+			reader.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported file mode %s for entry '%s'", mode, file.Name)
+		}
+	}
+	return e.checkSymlinks()
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %s", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %s", err)
+	}
+	return data, nil
+}
+
+func (e *archiveExtractor) createDir(name string, mode os.FileMode) error {
+	dirPath, err := e.entryPath(name)
+	if err != nil {
+		return err
+	}
+	log.Debug("Creating directory '%s'.\n", dirPath)
+	if err := os.MkdirAll(dirPath, mode); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	// We need this again because if the dir already existed os.MkdirAll does nothing
+	if err := os.Chmod(dirPath, mode); err != nil {
+		return fmt.Errorf("failed to change filemode: %s", err)
+	}
+	return nil
+}
+
+func (e *archiveExtractor) writeFile(name string, reader io.Reader, mode os.FileMode) error {
+	filePath, err := e.fileEntryPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(filePath), defaultDirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	log.Debug("Creating file '%s'.\n", filePath)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %s", err)
+	}
+	_, err = io.Copy(file, reader)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write file: %s", err)
+	}
+	if err := os.Chmod(filePath, mode); err != nil {
+		return fmt.Errorf("failed to change filemode: %s", err)
+	}
+	return nil
+}
+
+func (e *archiveExtractor) createSymlink(name, target string) error {
+	linkPath, err := e.fileEntryPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(linkPath), defaultDirMode); err != nil {
+		return fmt.Errorf("failed to create directory: %s", err)
+	}
+	log.Debug("Creating symlink from '%s' to '%s'.\n", linkPath, target)
+	if err := os.Symlink(target, linkPath); err != nil {
+		return fmt.Errorf("failed to create symlink: %s", err)
+	}
+	if err := e.checkSymlink(linkPath); err != nil {
+		os.Remove(linkPath)
+		return err
+	}
+	e.symlinks = append(e.symlinks, linkPath)
+	return nil
+}
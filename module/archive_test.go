@@ -0,0 +1,243 @@
+package module
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+type archiveEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	content  string
+}
+
+func dir(name string) archiveEntry {
+	return archiveEntry{name: name, typeflag: tar.TypeDir}
+}
+
+func file(name, content string) archiveEntry {
+	return archiveEntry{name: name, typeflag: tar.TypeReg, content: content}
+}
+
+func symlink(name, target string) archiveEntry {
+	return archiveEntry{name: name, typeflag: tar.TypeSymlink, linkname: target}
+}
+
+func hardlink(name, target string) archiveEntry {
+	return archiveEntry{name: name, typeflag: tar.TypeLink, linkname: target}
+}
+
+func writeTar(t *testing.T, entries []archiveEntry) *os.File {
+	archive, err := os.CreateTemp(t.TempDir(), "archive-*.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := tar.NewWriter(archive)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.linkname, Mode: 0644, Size: int64(len(entry.content))}
+		if entry.typeflag == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func writeZip(t *testing.T, entries []archiveEntry) *os.File {
+	archive, err := os.CreateTemp(t.TempDir(), "archive-*.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(archive)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		content := entry.content
+		switch entry.typeflag {
+		case tar.TypeDir:
+			header.Name += "/"
+			header.SetMode(os.ModeDir | 0755)
+		case tar.TypeSymlink:
+			header.SetMode(os.ModeSymlink | 0777)
+			content = entry.linkname
+		default:
+			header.SetMode(0644)
+		}
+		fileWriter, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fileWriter.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+func TestExtractArchive(t *testing.T) {
+	outside := t.TempDir()
+
+	cases := []struct {
+		name    string
+		entries []archiveEntry
+		allowed []string
+		err     string
+	}{
+		{"valid", []archiveEntry{
+			dir("root"), file("root/a.txt", "a"), dir("root/sub"), symlink("root/sub/link", "../a.txt"),
+			hardlink("root/hard", "root/a.txt"), symlink("root/self", "."),
+		}, nil, ""},
+		{"dot dot", []archiveEntry{dir("root"), file("root/../../escaped", "x")}, nil, "leaves the module directory"},
+		{"dot dot in subdirectory", []archiveEntry{dir("root"), file("root/sub/../../../escaped", "x")}, nil, "leaves the module directory"},
+		{"absolute symlink", []archiveEntry{dir("root"), symlink("root/link", outside)}, nil, "points outside of the module directory"},
+		{"relative symlink", []archiveEntry{dir("root"), symlink("root/link", "../../escaped")}, nil, "points outside of the module directory"},
+		{"symlink through symlink", []archiveEntry{
+			dir("root"), symlink("root/self", "."), symlink("root/link", "self/.."),
+		}, nil, "points outside of the module directory"},
+		{"symlink changed by later symlink", []archiveEntry{
+			dir("root"), dir("root/dir"), symlink("root/link", "dir/.."), symlink("root/dir2", "."), symlink("root/dir3", "dir2/.."),
+		}, nil, "points outside of the module directory"},
+		{"write through symlink", []archiveEntry{dir("root"), symlink("root/link", outside), file("root/link/escaped", "x")}, []string{outside}, "leaves the module directory"},
+		{"dot dot after symlink", []archiveEntry{
+			dir("root"), dir("root/a"), dir("root/a/b"), symlink("root/link", "a/b"), file("root/link/../../../escaped", "x"),
+		}, nil, "leaves the module directory"},
+		{"allowed symlink", []archiveEntry{dir("root"), symlink("root/link", outside)}, []string{outside}, ""},
+		{"allowed parent directory", []archiveEntry{dir("root"), symlink("root/link", path.Join(outside, "file"))}, []string{outside}, ""},
+		{"hard link", []archiveEntry{dir("root"), hardlink("root/link", "root/../../escaped")}, nil, "leaves the module directory"},
+	}
+
+	for _, c := range cases {
+		for _, format := range []string{"tar", "zip"} {
+			if format == "zip" && c.entries[len(c.entries)-1].typeflag == tar.TypeLink {
+				continue
+			}
+
+			var archive *os.File
+			if format == "tar" {
+				archive = writeTar(t, c.entries)
+			} else {
+				archive = writeZip(t, c.entries)
+			}
+			workspace := t.TempDir()
+			modulePath := path.Join(workspace, "DEPS", "mod")
+			AllowedSymlinkTargets = c.allowed
+
+			err := TarModule{path: modulePath}.extract(archive.Name(), archive)
+			archive.Close()
+			if c.err == "" && err != nil {
+				t.Errorf("%s (%s): unexpected error: %s", c.name, format, err)
+			}
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("%s (%s): expected error containing %q, got %v", c.name, format, c.err, err)
+			}
+			for _, escaped := range []string{path.Join(workspace, "escaped"), path.Join(workspace, "DEPS", "escaped"), path.Join(outside, "escaped")} {
+				if _, err := os.Lstat(escaped); err == nil {
+					t.Errorf("%s (%s): '%s' was written outside of the module directory", c.name, format, escaped)
+				}
+			}
+		}
+	}
+	AllowedSymlinkTargets = nil
+}
+
+func TestExtractArchiveReplacesSymlinks(t *testing.T) {
+	modulePath := path.Join(t.TempDir(), "mod")
+	archive := writeTar(t, []archiveEntry{dir("root"), file("root/a.txt", "a"), symlink("root/b.txt", "a.txt"), file("root/b.txt", "b")})
+	defer archive.Close()
+
+	if err := (TarModule{path: modulePath}).extract(archive.Name(), archive); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"a.txt": "a", "b.txt": "b"} {
+		content, err := os.ReadFile(path.Join(modulePath, name))
+		if err != nil || string(content) != expected {
+			t.Errorf("%s has content %q (%v); expected %q", name, content, err, expected)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(path.Join(root, "a", "b"), 0755)
+	os.Symlink("a/b", path.Join(root, "deep"))
+	os.Symlink(".", path.Join(root, "self"))
+	os.Symlink("loop", path.Join(root, "loop"))
+
+	cases := []struct {
+		path     string
+		resolved string
+	}{
+		{"a/b", "a/b"},
+		{"deep", "a/b"},
+		{"deep/..", "a"},
+		{"deep/../../missing", "missing"},
+		{"self/self/a", "a"},
+		{"self/..", ".."},
+		{"missing/../a", "a"},
+	}
+	for _, c := range cases {
+		resolved, err := resolvePath(path.Join(root, ".") + "/" + c.path)
+		if err != nil || resolved != path.Join(root, c.resolved) {
+			t.Errorf("resolvePath(%q) = %q, %v; expected %q", c.path, resolved, err, path.Join(root, c.resolved))
+		}
+	}
+
+	if _, err := resolvePath(path.Join(root, "loop")); err == nil {
+		t.Errorf("resolvePath did not fail for a symlink loop")
+	}
+}
+
+func TestCloneUpdatesStaleMirror(t *testing.T) {
+	archive := writeTar(t, []archiveEntry{dir("root"), file("root/a.txt", "new"), symlink("root/b.txt", "a.txt")})
+	content, err := os.ReadFile(archive.Name())
+	archive.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+	url := server.URL + "/archive.tar"
+	hash := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	mirror := &TarMirror{path: path.Join(t.TempDir(), "mirror")}
+	util.MkdirAll(mirror.path)
+	util.WriteFile(path.Join(mirror.path, "a.txt"), []byte("old"))
+	util.WriteYaml(path.Join(mirror.path, tarMetadataFileName), metadataFile{url, "stale"})
+
+	modulePath := path.Join(t.TempDir(), "mod")
+	if err := (TarModule{path: modulePath, mirror: mirror}).clone(url, hash); err != nil {
+		t.Fatal(err)
+	}
+	if mirrorHash := (TarModule{path: mirror.path}).Head(); mirrorHash != hash {
+		t.Errorf("The mirror has hash %q; expected %q", mirrorHash, hash)
+	}
+	if content, err := os.ReadFile(path.Join(mirror.path, "a.txt")); err != nil || string(content) != "new" {
+		t.Errorf("The mirror has content %q (%v); expected the downloaded archive", content, err)
+	}
+	if target, err := os.Readlink(path.Join(mirror.path, "b.txt")); err != nil || target != "a.txt" {
+		t.Errorf("The mirror has symlink target %q (%v); expected %q", target, err, "a.txt")
+	}
+}
@@ -0,0 +1,167 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/netrc"
+)
+
+// commandTokens caches the tokens printed by the token commands of credentials, so that every
+// command only runs once.
+var commandTokens = map[string]string{}
+var commandTokensMutex sync.Mutex
+
+// netrcWarningOnce makes sure that an unusable netrc file is only reported once.
+var netrcWarningOnce sync.Once
+
+// prefixMatches reports whether `rawUrl` starts with the URL prefix `prefix`. Scheme, host and port
+// must be the same, and the path of the prefix must match whole path segments, so that a prefix never
+// matches a look-alike host such as 'https://example.com.evil.org/'.
+func prefixMatches(prefix, rawUrl string) bool {
+	prefixUrl, err := url.Parse(prefix)
+	if err != nil || prefixUrl.Host == "" {
+		return false
+	}
+	requestUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return false
+	}
+
+	portOf := func(u *url.URL) string {
+		if port := u.Port(); port != "" {
+			return port
+		}
+		return defaultPort(strings.ToLower(u.Scheme))
+	}
+	if !strings.EqualFold(prefixUrl.Scheme, requestUrl.Scheme) ||
+		!strings.EqualFold(prefixUrl.Hostname(), requestUrl.Hostname()) ||
+		portOf(prefixUrl) != portOf(requestUrl) {
+		return false
+	}
+
+	prefixPath := strings.TrimSuffix(prefixUrl.EscapedPath(), "/")
+	requestPath := requestUrl.EscapedPath()
+	return prefixPath == "" || requestPath == prefixPath || strings.HasPrefix(requestPath, prefixPath+"/")
+}
+
+// findCredential returns the credential with the longest prefix that matches `url`.
+func findCredential(credentials []config.Credential, url string) (config.Credential, bool) {
+	best := -1
+	for idx, credential := range credentials {
+		if credential.Prefix == "" || !prefixMatches(credential.Prefix, url) {
+			continue
+		}
+		if best == -1 || len(credential.Prefix) > len(credentials[best].Prefix) {
+			best = idx
+		}
+	}
+	if best == -1 {
+		return config.Credential{}, false
+	}
+	return credentials[best], true
+}
+
+// credentialToken returns the token of the credential. Errors never contain the token.
+func credentialToken(credential config.Credential) (string, error) {
+	switch {
+	case credential.Token != "":
+		return credential.Token, nil
+	case credential.TokenEnv != "":
+		token, ok := os.LookupEnv(credential.TokenEnv)
+		if !ok || token == "" {
+			return "", fmt.Errorf("the environment variable '%s' of the credentials for '%s' is not set", credential.TokenEnv, credential.Prefix)
+		}
+		return token, nil
+	case len(credential.TokenCommand) > 0:
+		return commandToken(credential)
+	}
+	return "", fmt.Errorf("the credentials for '%s' have no token, token-env or token-command", credential.Prefix)
+}
+
+func commandToken(credential config.Credential) (string, error) {
+	key := strings.Join(credential.TokenCommand, "\x00")
+	commandTokensMutex.Lock()
+	defer commandTokensMutex.Unlock()
+	if token, ok := commandTokens[key]; ok {
+		return token, nil
+	}
+
+	log.Debug("Running the token command '%s' of the credentials for '%s'.\n", credential.TokenCommand[0], credential.Prefix)
+	cmd := exec.Command(credential.TokenCommand[0], credential.TokenCommand[1:]...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("the token command '%s' of the credentials for '%s' failed: %s", credential.TokenCommand[0], credential.Prefix, err)
+	}
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", fmt.Errorf("the token command '%s' of the credentials for '%s' printed no token", credential.TokenCommand[0], credential.Prefix)
+	}
+	commandTokens[key] = token
+	return token, nil
+}
+
+// authenticate adds the credentials for its URL to `request`: the credentials in the user configuration
+// with the longest matching prefix, or the credentials in the netrc file. Credentials are never logged.
+func authenticate(request *http.Request) error {
+	url := request.URL.String()
+	credential, ok := findCredential(config.GetConfig().Credentials, url)
+	if !ok {
+		auth, err := netrc.GetAuthForUrl(url)
+		if err != nil {
+			// Downloads that do not need credentials should not fail because of the netrc file.
+			netrcWarningOnce.Do(func() {
+				log.Warning("Not using the netrc file: %s.\n", err)
+			})
+			return nil
+		}
+		if auth != nil {
+			log.Debug("Using netrc auth for url %q\n", url)
+			request.SetBasicAuth(auth.User, auth.Password)
+		}
+		return nil
+	}
+
+	token, err := credentialToken(credential)
+	if err != nil {
+		return err
+	}
+	log.Debug("Using %s credentials for '%s' for url %q.\n", credential.Type, credential.Prefix, url)
+	switch credential.Type {
+	case "basic":
+		request.SetBasicAuth(credential.User, token)
+	case "bearer":
+		request.Header.Set("Authorization", "Bearer "+token)
+	case "header":
+		if credential.Header == "" {
+			return fmt.Errorf("the credentials for '%s' have type 'header', but no header", credential.Prefix)
+		}
+		request.Header.Set(credential.Header, token)
+	default:
+		return fmt.Errorf("the credentials for '%s' have unknown type '%s'. Use 'basic', 'bearer' or 'header'", credential.Prefix, credential.Type)
+	}
+	return nil
+}
+
+// reauthenticate replaces the credentials of a request that is redirected, since the credentials of
+// the original URL must not be sent to another server.
+func reauthenticate(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	request.Header.Del("Authorization")
+	for _, credential := range config.GetConfig().Credentials {
+		if credential.Header != "" {
+			request.Header.Del(credential.Header)
+		}
+	}
+	return authenticate(request)
+}
@@ -0,0 +1,68 @@
+package module
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/daedaleanai/dbt/v3/config"
+)
+
+func TestFindCredential(t *testing.T) {
+	credentials := []config.Credential{
+		{Prefix: "https://example.com/", Type: "basic"},
+		{Prefix: "https://example.com/sdk/", Type: "bearer"},
+		{Prefix: "", Type: "header"},
+		{Prefix: "https://artifacts.example.com", Type: "header"},
+		{Prefix: "https://repo.example.com:8443/releases", Type: "basic"},
+	}
+
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"https://example.com/sdk/core.tar.gz", "bearer"},
+		{"https://example.com/other.tar.gz", "basic"},
+		{"https://example.org/other.tar.gz", ""},
+		{"https://EXAMPLE.com:443/sdk/core.tar.gz", "bearer"},
+		{"http://example.com/other.tar.gz", ""},
+		{"https://example.com:8443/other.tar.gz", ""},
+		{"https://artifacts.example.com/a.tar.gz", "header"},
+		{"https://artifacts.example.com", "header"},
+		{"https://artifacts.example.com.evil.org/a.tar.gz", ""},
+		{"https://artifacts.example.com@evil.org/a.tar.gz", ""},
+		{"https://artifacts.example.community/a.tar.gz", ""},
+		{"https://repo.example.com:8443/releases/a.tar.gz", "basic"},
+		{"https://repo.example.com:8443/releases-evil/a.tar.gz", ""},
+		{"https://repo.example.com/releases/a.tar.gz", ""},
+	}
+	for _, c := range cases {
+		credential, ok := findCredential(credentials, c.url)
+		if (c.expected == "" && ok) || (c.expected != "" && credential.Type != c.expected) {
+			t.Errorf("findCredential(%q) = %q, %v; expected %q", c.url, credential.Type, ok, c.expected)
+		}
+	}
+}
+
+func TestCredentialToken(t *testing.T) {
+	t.Setenv("DBT_TEST_TOKEN", "from-env")
+
+	cases := []struct {
+		credential config.Credential
+		token      string
+		err        string
+	}{
+		{config.Credential{Token: "literal"}, "literal", ""},
+		{config.Credential{TokenEnv: "DBT_TEST_TOKEN"}, "from-env", ""},
+		{config.Credential{TokenEnv: "DBT_TEST_MISSING_TOKEN"}, "", "is not set"},
+		{config.Credential{TokenCommand: []string{"echo", "from-command"}}, "from-command", ""},
+		{config.Credential{TokenCommand: []string{"false"}}, "", "failed"},
+		{config.Credential{TokenCommand: []string{"true"}}, "", "printed no token"},
+		{config.Credential{}, "", "have no token"},
+	}
+	for _, c := range cases {
+		token, err := credentialToken(c.credential)
+		if token != c.token || (c.err == "" && err != nil) || (c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err))) {
+			t.Errorf("credentialToken(%+v) = %q, %v; expected %q, %q", c.credential, token, err, c.token, c.err)
+		}
+	}
+}
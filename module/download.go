@@ -0,0 +1,290 @@
+package module
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+)
+
+const (
+	defaultHTTPTimeout     = 30 * time.Second
+	defaultHTTPIdleTimeout = time.Minute
+	defaultHTTPRetries     = 3
+	defaultHTTPRetryDelay  = time.Second
+)
+
+const progressInterval = 200 * time.Millisecond
+
+// DownloadProgress controls whether the progress of downloads is shown. By default, it is shown
+// if stderr is a terminal.
+var DownloadProgress = isTerminal(os.Stderr)
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && (info.Mode()&os.ModeCharDevice) == os.ModeCharDevice
+}
+
+// httpSettings are the timeouts and retries of downloads, see config.HTTPConfig.
+type httpSettings struct {
+	timeout     time.Duration
+	idleTimeout time.Duration
+	retries     int
+	retryDelay  time.Duration
+	progress    bool
+	// logger prints the retries and progress of downloads.
+	logger *log.Logger
+	proxy  proxySettings
+	// rootCAs are the trusted CA certificates, or nil to trust the certificates of the system.
+	rootCAs *x509.CertPool
+}
+
+func readHTTPSettings() httpSettings {
+	httpConfig := config.GetConfig().HTTP
+	settings := httpSettings{
+		timeout:     parseHTTPDuration("timeout", httpConfig.Timeout, defaultHTTPTimeout),
+		idleTimeout: parseHTTPDuration("idle-timeout", httpConfig.IdleTimeout, defaultHTTPIdleTimeout),
+		retries:     defaultHTTPRetries,
+		retryDelay:  parseHTTPDuration("retry-delay", httpConfig.RetryDelay, defaultHTTPRetryDelay),
+		progress:    DownloadProgress,
+		proxy:       readProxySettings(),
+		rootCAs:     rootCAs(),
+	}
+	if httpConfig.Retries != nil {
+		if *httpConfig.Retries < 0 {
+			log.Fatal("Invalid value %d for 'retries' in the http configuration. Use 0 or more.\n", *httpConfig.Retries)
+		}
+		settings.retries = *httpConfig.Retries
+	}
+	return settings
+}
+
+func parseHTTPDuration(name, value string, defaultDuration time.Duration) time.Duration {
+	if value == "" {
+		return defaultDuration
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Fatal("Invalid value '%s' for '%s' in the http configuration. Use a positive duration like '30s'.\n", value, name)
+	}
+	return duration
+}
+
+func newHTTPClient(settings httpSettings) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: settings.timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = settings.timeout
+	transport.ResponseHeaderTimeout = settings.timeout
+	transport.Proxy = settings.proxy.proxyForRequest
+	if settings.rootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: settings.rootCAs}
+	}
+	return &http.Client{Transport: transport, CheckRedirect: reauthenticate}
+}
+
+// permanentError is a download error that does not go away by retrying.
+type permanentError struct {
+	error
+}
+
+// downloader downloads a file over HTTP. If an attempt fails, the next attempt resumes the download
+// with a range request if the server supports them.
+type downloader struct {
+	url      string
+	settings httpSettings
+	client   *http.Client
+	file     *os.File
+	// size is the number of bytes downloaded so far.
+	size int64
+	// total is the size of the file, or -1 if it is unknown.
+	total int64
+	// validator is the ETag or modification time of the file, which ensures that resumed downloads
+	// continue the same file.
+	validator    string
+	resumable    bool
+	lastProgress time.Time
+}
+
+// downloadFile downloads `url` into `file`. Failed downloads are retried with exponential backoff.
+func downloadFile(url string, file *os.File, settings httpSettings) error {
+	d := downloader{url: url, settings: settings, client: newHTTPClient(settings), file: file, total: -1}
+	delay := settings.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := d.attempt()
+		if settings.progress {
+			settings.logger.Progress("")
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= settings.retries || errors.As(err, &permanentError{}) {
+			return fmt.Errorf("failed to download archive: %s", err)
+		}
+		settings.logger.Warning("Downloading '%s' failed: %s. Retrying in %s.\n", url, err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// restart discards the downloaded data.
+func (d *downloader) restart() error {
+	d.size = 0
+	if err := d.file.Truncate(0); err != nil {
+		return permanentError{err}
+	}
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return permanentError{err}
+	}
+	return nil
+}
+
+func (d *downloader) attempt() error {
+	if d.size > 0 && !d.resumable {
+		log.Debug("The server does not support range requests. Restarting the download of '%s'.\n", d.url)
+		if err := d.restart(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, "GET", d.url, nil)
+	if err != nil {
+		return permanentError{fmt.Errorf("failed to construct HTTP request: %s", err)}
+	}
+	if err := authenticate(request); err != nil {
+		return permanentError{err}
+	}
+	if d.size > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.size))
+		if d.validator != "" {
+			request.Header.Set("If-Range", d.validator)
+		}
+	}
+
+	response, err := d.client.Do(request)
+	var certificateErr *tls.CertificateVerificationError
+	if errors.As(err, &certificateErr) {
+		return permanentError{err}
+	}
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent && d.size > 0:
+		start, total, ok := parseContentRange(response.Header.Get("Content-Range"))
+		if !ok || start != d.size {
+			d.resumable = false
+			return fmt.Errorf("the server resumed the download at the wrong position")
+		}
+		log.Debug("Resuming the download of '%s' after %d bytes.\n", d.url, d.size)
+		d.total = total
+	case response.StatusCode == http.StatusOK:
+		if d.size > 0 {
+			log.Debug("The server sent the whole file again. Restarting the download of '%s'.\n", d.url)
+			if err := d.restart(); err != nil {
+				return err
+			}
+		}
+		d.total = response.ContentLength
+		d.resumable = response.Header.Get("Accept-Ranges") == "bytes"
+		d.validator = response.Header.Get("ETag")
+		if d.validator == "" || strings.HasPrefix(d.validator, "W/") {
+			d.validator = response.Header.Get("Last-Modified")
+		}
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.size > 0:
+		d.resumable = false
+		return fmt.Errorf("the server can not resume the download")
+	case response.StatusCode >= 500 || response.StatusCode == http.StatusRequestTimeout || response.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("the server responded with '%s'", response.Status)
+	default:
+		return permanentError{fmt.Errorf("the server responded with '%s'", response.Status)}
+	}
+
+	// The request is cancelled if no data arrives for too long.
+	idleTimer := time.AfterFunc(d.settings.idleTimeout, cancel)
+	defer idleTimer.Stop()
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := response.Body.Read(buffer)
+		idleTimer.Reset(d.settings.idleTimeout)
+		if n > 0 {
+			if _, err := d.file.Write(buffer[:n]); err != nil {
+				return permanentError{fmt.Errorf("failed to write archive: %s", err)}
+			}
+			d.size += int64(n)
+			d.showProgress()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("no data received for %s", d.settings.idleTimeout)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.total >= 0 && d.size != d.total {
+		return fmt.Errorf("the download ended after %d of %d bytes", d.size, d.total)
+	}
+	return nil
+}
+
+// parseContentRange returns the first byte and the size of the file from a Content-Range header
+// like "bytes 100-199/200". The size is -1 if it is unknown.
+func parseContentRange(contentRange string) (int64, int64, bool) {
+	var start, end int64
+	var total string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, 0, false
+	}
+	if total == "*" {
+		return start, -1, true
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+func (d *downloader) showProgress() {
+	if !d.settings.progress || time.Since(d.lastProgress) < progressInterval {
+		return
+	}
+	d.lastProgress = time.Now()
+	if d.total > 0 {
+		d.settings.logger.Progress("%s / %s (%d%%)", formatBytes(d.size), formatBytes(d.total), d.size*100/d.total)
+	} else {
+		d.settings.logger.Progress("%s", formatBytes(d.size))
+	}
+}
+
+func formatBytes(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,246 @@
+package module
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testArchiveContent = bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+
+var testHTTPSettings = httpSettings{
+	timeout:     time.Second,
+	idleTimeout: 100 * time.Millisecond,
+	retries:     2,
+	retryDelay:  time.Millisecond,
+}
+
+// testServer serves testArchiveContent. `handler` is called for every request with the number of
+// the request and can serve it instead by returning true.
+type testServer struct {
+	mutex    sync.Mutex
+	requests []*http.Request
+	handler  func(request int, w http.ResponseWriter, r *http.Request) bool
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, r)
+	request := len(s.requests)
+	s.mutex.Unlock()
+
+	if s.handler != nil && s.handler(request, w, r) {
+		return
+	}
+	w.Header().Set("ETag", `"v1"`)
+	http.ServeContent(w, r, "archive.tar.gz", time.Time{}, bytes.NewReader(testArchiveContent))
+}
+
+// serveTruncated sends the headers of the whole archive, but only the first half of its content.
+func serveTruncated(w http.ResponseWriter, acceptRanges bool) {
+	if acceptRanges {
+		w.Header().Set("Accept-Ranges", "bytes")
+	}
+	w.Header().Set("ETag", `"v1"`)
+	w.Header().Set("Content-Length", fmt.Sprint(len(testArchiveContent)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(testArchiveContent[:len(testArchiveContent)/2])
+	panic(http.ErrAbortHandler)
+}
+
+func runTestDownload(t *testing.T, server *testServer) ([]byte, error) {
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	file, err := os.CreateTemp(t.TempDir(), "archive-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = downloadFile(httpServer.URL+"/archive.tar.gz", file, testHTTPSettings)
+	content, readErr := os.ReadFile(file.Name())
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	return content, err
+}
+
+func TestDownloadFile(t *testing.T) {
+	server := &testServer{}
+	content, err := runTestDownload(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testArchiveContent) {
+		t.Errorf("downloaded %d bytes that do not match the archive", len(content))
+	}
+	if len(server.requests) != 1 {
+		t.Errorf("expected 1 request, got %d", len(server.requests))
+	}
+}
+
+func TestDownloadFileStatusErrors(t *testing.T) {
+	cases := []struct {
+		status   int
+		requests int
+	}{
+		{http.StatusNotFound, 1},
+		{http.StatusForbidden, 1},
+		{http.StatusInternalServerError, 3},
+		{http.StatusServiceUnavailable, 3},
+		{http.StatusTooManyRequests, 3},
+	}
+
+	for _, c := range cases {
+		server := &testServer{handler: func(request int, w http.ResponseWriter, r *http.Request) bool {
+			http.Error(w, "<html>error</html>", c.status)
+			return true
+		}}
+		_, err := runTestDownload(t, server)
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprint(c.status)) {
+			t.Errorf("status %d: expected an error with the status code, got %v", c.status, err)
+		}
+		if len(server.requests) != c.requests {
+			t.Errorf("status %d: expected %d requests, got %d", c.status, c.requests, len(server.requests))
+		}
+	}
+}
+
+func TestDownloadFileRetries(t *testing.T) {
+	server := &testServer{handler: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		if request < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}}
+	content, err := runTestDownload(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testArchiveContent) || len(server.requests) != 3 {
+		t.Errorf("downloaded %d bytes in %d requests", len(content), len(server.requests))
+	}
+}
+
+func TestDownloadFileResumes(t *testing.T) {
+	server := &testServer{handler: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		if request == 1 {
+			serveTruncated(w, true)
+		}
+		return false
+	}}
+	content, err := runTestDownload(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testArchiveContent) {
+		t.Errorf("downloaded %d bytes that do not match the archive", len(content))
+	}
+	if len(server.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(server.requests))
+	}
+	resumed := server.requests[1]
+	if expected := fmt.Sprintf("bytes=%d-", len(testArchiveContent)/2); resumed.Header.Get("Range") != expected {
+		t.Errorf("expected range %q, got %q", expected, resumed.Header.Get("Range"))
+	}
+	if resumed.Header.Get("If-Range") != `"v1"` {
+		t.Errorf("expected If-Range header with the ETag, got %q", resumed.Header.Get("If-Range"))
+	}
+}
+
+func TestDownloadFileRestarts(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler func(request int, w http.ResponseWriter, r *http.Request) bool
+	}{
+		{"no range support", func(request int, w http.ResponseWriter, r *http.Request) bool {
+			if request == 1 {
+				serveTruncated(w, false)
+			}
+			return false
+		}},
+		{"range ignored", func(request int, w http.ResponseWriter, r *http.Request) bool {
+			if request == 1 {
+				serveTruncated(w, true)
+			}
+			w.Write(testArchiveContent)
+			return true
+		}},
+		{"file changed", func(request int, w http.ResponseWriter, r *http.Request) bool {
+			if request == 1 {
+				serveTruncated(w, true)
+			}
+			// The ETag does not match anymore, so the server sends the whole file.
+			w.Header().Set("ETag", `"v2"`)
+			http.ServeContent(w, r, "archive.tar.gz", time.Time{}, bytes.NewReader(testArchiveContent))
+			return true
+		}},
+	}
+
+	for _, c := range cases {
+		server := &testServer{handler: c.handler}
+		content, err := runTestDownload(t, server)
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		}
+		if !bytes.Equal(content, testArchiveContent) {
+			t.Errorf("%s: downloaded %d bytes that do not match the archive", c.name, len(content))
+		}
+	}
+}
+
+func TestDownloadFileIdleTimeout(t *testing.T) {
+	server := &testServer{handler: func(request int, w http.ResponseWriter, r *http.Request) bool {
+		if request > 1 {
+			return false
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(testArchiveContent)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(testArchiveContent[:1024])
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return true
+	}}
+	start := time.Now()
+	content, err := runTestDownload(t, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, testArchiveContent) {
+		t.Errorf("downloaded %d bytes that do not match the archive", len(content))
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("the stalled download was not aborted after the idle timeout")
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	cases := []struct {
+		header string
+		start  int64
+		total  int64
+		ok     bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-0/*", 0, -1, true},
+		{"bytes */200", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, c := range cases {
+		start, total, ok := parseContentRange(c.header)
+		if start != c.start || total != c.total || ok != c.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v; expected %d, %d, %v", c.header, start, total, ok, c.start, c.total, c.ok)
+		}
+	}
+}
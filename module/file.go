@@ -1,8 +1,10 @@
 package module
 
 import (
+	"fmt"
 	"path"
 
+	"github.com/daedaleanai/dbt/v3/config"
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/util"
 )
@@ -16,8 +18,37 @@ type moduleFileVersion struct {
 type Dependency struct {
 	URL     string
 	Version string
-	Hash    string
+	Hash    string `yaml:",omitempty"`
 	Type    string
+	// Depth limits the history of a git dependency to the given number of commits when it is cloned.
+	Depth int `yaml:",omitempty"`
+	// Filter is passed as `--filter` when cloning a git dependency (e.g., `blob:none`).
+	Filter string `yaml:",omitempty"`
+	// Subdir is the directory of the module inside of the repository or archive.
+	Subdir string `yaml:",omitempty"`
+}
+
+// CloneOptions limit the history and objects that are fetched when cloning a git dependency,
+// and select the subdirectory of the repository that holds the module.
+type CloneOptions struct {
+	Depth  int
+	Filter string
+	Subdir string
+	// Hash is the hash the dependency is pinned to. Archives with a different hash are not extracted.
+	Hash string
+	// Logger prints the messages of cloning and fetching the module. Modules that are cloned in
+	// parallel use a buffered logger each, so that their messages do not interleave.
+	Logger *log.Logger
+}
+
+// IsSet reports whether the clone is shallow or partial.
+func (o CloneOptions) IsSet() bool {
+	return o.Depth > 0 || o.Filter != ""
+}
+
+// CloneOptions returns the options for cloning the dependency.
+func (d Dependency) CloneOptions() CloneOptions {
+	return CloneOptions{Depth: d.Depth, Filter: d.Filter, Subdir: d.Subdir, Hash: d.Hash}
 }
 
 type ModuleFile struct {
@@ -26,6 +57,32 @@ type ModuleFile struct {
 	Dependencies map[string]Dependency
 	Flags        map[string]string
 	PersistFlags *bool `yaml:"persist-flags,omitempty"`
+	// UseLockFile keeps resolved hashes in MODULE.lock instead of the MODULE file.
+	UseLockFile bool `yaml:"lock-file,omitempty"`
+	// Setup restricts the execution of SETUP.go scripts. It only applies to the top-level MODULE file.
+	Setup *config.SetupPolicy `yaml:",omitempty"`
+	// Hooks are run by 'dbt sync' at specific points of the sync.
+	Hooks Hooks `yaml:",omitempty"`
+}
+
+// Hooks lists the hooks of a module for each point of the sync.
+type Hooks struct {
+	// PreSync hooks run before the sync starts. Only the hooks of the top-level module run.
+	PreSync []Hook `yaml:"pre-sync,omitempty"`
+	// PostCheckout hooks run after the module has been cloned or checked out.
+	PostCheckout []Hook `yaml:"post-checkout,omitempty"`
+	// PostSync hooks run after all modules have been checked out.
+	PostSync []Hook `yaml:"post-sync,omitempty"`
+}
+
+// Hook is a Go program or a command that runs in the root directory of the module.
+type Hook struct {
+	// Go is the path of a Go program relative to the root of the module, which runs with 'go run'.
+	Go string `yaml:",omitempty"`
+	// Command is a command and its arguments.
+	Command []string `yaml:",omitempty"`
+	// Timeout is the time limit of the hook (e.g., "2m"). It defaults to one minute.
+	Timeout string `yaml:",omitempty"`
 }
 
 // MODULE file version 2
@@ -79,17 +136,36 @@ func ReadModuleFile(modulePath string) ModuleFile {
 		}
 	}
 
+	return parseModuleFile(moduleFilePath, util.ReadFile(moduleFilePath))
+}
+
+// ReadModuleFileAt reads and parses the MODULE file of a module as of revision `rev`,
+// without checking out that revision.
+func ReadModuleFileAt(mod Module, rev string) ModuleFile {
+	data, exists := mod.ReadFile(rev, util.ModuleFileName)
+	if !exists {
+		log.Debug("Module has no %s file at revision '%s'.\n", util.ModuleFileName, rev)
+		return ModuleFile{
+			Version:      util.ModuleSyntaxVersion,
+			Dependencies: map[string]Dependency{},
+		}
+	}
+
+	return parseModuleFile(fmt.Sprintf("%s@%s", path.Join(mod.RootPath(), util.ModuleFileName), rev), data)
+}
+
+func parseModuleFile(source string, data []byte) ModuleFile {
 	// Check MODULE file version.
 	var moduleFileVersion moduleFileVersion
-	util.ReadYaml(moduleFilePath, &moduleFileVersion)
+	util.ParseYaml(source, data, &moduleFileVersion)
 
 	switch moduleFileVersion.Version {
 	case 1:
-		return readV1ModuleFile(moduleFilePath)
+		return readV1ModuleFile(source, data)
 	case 2:
-		return readV2ModuleFile(moduleFilePath)
+		return readV2ModuleFile(source, data)
 	case 3:
-		return readV3ModuleFile(moduleFilePath)
+		return readV3ModuleFile(source, data)
 	default:
 		log.Fatal("MODULE file has unknown syntax version %d. It is either a mistake in the file or a newer version of dbt is required.\n", moduleFileVersion.Version)
 		return ModuleFile{}
@@ -103,9 +179,9 @@ func WriteModuleFile(modulePath string, moduleFile ModuleFile) {
 	util.WriteYaml(moduleFilePath, moduleFile)
 }
 
-func readV1ModuleFile(path string) ModuleFile {
+func readV1ModuleFile(source string, data []byte) ModuleFile {
 	v1ModuleFile := v1ModuleFile{}
-	util.ReadYaml(path, &v1ModuleFile)
+	util.ParseYaml(source, data, &v1ModuleFile)
 
 	moduleFile := ModuleFile{
 		Version:      util.ModuleSyntaxVersion,
@@ -122,9 +198,9 @@ func readV1ModuleFile(path string) ModuleFile {
 	return moduleFile
 }
 
-func readV2ModuleFile(path string) ModuleFile {
+func readV2ModuleFile(source string, data []byte) ModuleFile {
 	v2ModuleFile := v2ModuleFile{}
-	util.ReadYaml(path, &v2ModuleFile)
+	util.ParseYaml(source, data, &v2ModuleFile)
 
 	moduleFile := ModuleFile{
 		Version:      util.ModuleSyntaxVersion,
@@ -142,9 +218,9 @@ func readV2ModuleFile(path string) ModuleFile {
 	return moduleFile
 }
 
-func readV3ModuleFile(path string) ModuleFile {
+func readV3ModuleFile(source string, data []byte) ModuleFile {
 	moduleFile := ModuleFile{}
-	util.ReadYaml(path, &moduleFile)
+	util.ParseYaml(source, data, &moduleFile)
 
 	// YAML decoding can produce `nil`` maps if the key is present in the YAML file
 	// but has no entries.
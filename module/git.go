@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os/exec"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/daedaleanai/dbt/v3/config"
@@ -13,10 +15,18 @@ import (
 	"github.com/daedaleanai/dbt/v3/util"
 )
 
+var commitHashRe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
 // GitModule is a module backed by a git repository.
 type GitModule struct {
 	path   string
 	mirror *GitMirror
+	// repoPath is the root of the repository if the module is a subdirectory of the repository.
+	repoPath string
+	// subdir is the path of the module relative to repoPath.
+	subdir string
+	// logger prints the messages of cloning and fetching the module, see CloneOptions.Logger.
+	logger *log.Logger
 }
 
 // GitMirror is a bare repository that backs a GitModule
@@ -24,17 +34,33 @@ type GitMirror struct {
 	path string
 }
 
-// Obtains a mirror for a git repository if the global mirror directory has been set up
-func getOrCreateGitMirror(url string) (*GitMirror, error) {
+// Returns the path of the mirror for a git repository, or an empty string if the global mirror
+// directory has not been set up.
+func gitMirrorPath(url string) string {
 	configuration := config.GetConfig()
 	if configuration.Mirror == "" {
-		log.Debug("Mirrors are not configured.\n")
-		return nil, nil
+		return ""
 	}
 
 	urlHash := sha256.Sum256([]byte(url))
 	urlHashString := fmt.Sprintf("git-%x", urlHash[:])
-	mirrorPath := path.Join(configuration.Mirror, urlHashString)
+	return path.Join(configuration.Mirror, urlHashString)
+}
+
+// Obtains a mirror for a git repository if the global mirror directory has been set up
+func getOrCreateGitMirror(url string) (*GitMirror, error) {
+	mirrorPath := gitMirrorPath(url)
+	if mirrorPath == "" {
+		log.Debug("Mirrors are not configured.\n")
+		return nil, nil
+	}
+	return openOrCreateGitMirror(url, mirrorPath)
+}
+
+// openOrCreateGitMirror opens the mirror of `url` at `mirrorPath`, or clones it if it does not exist yet.
+func openOrCreateGitMirror(url, mirrorPath string) (*GitMirror, error) {
+	// Several modules might use the same mirror when they are cloned in parallel.
+	defer lockMirror(mirrorPath)()
 
 	log.Debug("Looking for mirror of '%s' in directory '%s'.\n", url, mirrorPath)
 
@@ -43,9 +69,16 @@ func getOrCreateGitMirror(url string) (*GitMirror, error) {
 		return &GitMirror{path: mirrorPath}, nil
 	}
 
+	if Offline || ReadOnly {
+		log.Debug("No mirror found. Not creating a mirror in offline or read-only mode.\n")
+		return nil, nil
+	}
+
 	util.MkdirAll(mirrorPath)
-	mod := GitModule{mirrorPath, nil}
-	if err := mod.clone(url, true); err != nil {
+	mod := GitModule{path: mirrorPath}
+	if err := mod.clone(url, true, CloneOptions{}); err != nil {
+		// Leave a clean tree so that the operation can be retried.
+		util.RemoveDir(mirrorPath)
 		return nil, err
 	}
 	log.Debug("Mirror cloned at '%s'.\n", mirrorPath)
@@ -56,15 +89,26 @@ func getOrCreateGitMirror(url string) (*GitMirror, error) {
 // createGitModule creates a new GitModule in the given `modulePath`
 // by cloning the repository from `url`.
 func CreateGitModule(modulePath, url string) (Module, error) {
-	// Figure out if there is a local mirror for it
-	mirror, err := getOrCreateGitMirror(url)
-	if err != nil {
-		return nil, err
+	return createGitModule(modulePath, url, CloneOptions{})
+}
+
+func createGitModule(modulePath, url string, options CloneOptions) (Module, error) {
+	var mirror *GitMirror
+	if options.IsSet() && !Offline {
+		// Mirrors always hold the full repository, which is exactly what shallow and partial clones avoid.
+		log.Debug("Not using a mirror for a shallow or partial clone.\n")
+	} else {
+		// Figure out if there is a local mirror for it
+		var err error
+		mirror, err = getOrCreateGitMirror(url)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	mod := GitModule{modulePath, mirror}
+	mod := GitModule{path: modulePath, mirror: mirror, logger: options.Logger}
 	util.MkdirAll(modulePath)
-	if err := mod.clone(url, false); err != nil {
+	if err := mod.clone(url, false, options); err != nil {
 		return nil, err
 	}
 
@@ -72,6 +116,10 @@ func CreateGitModule(modulePath, url string) (Module, error) {
 }
 
 func (m GitModule) Name() string {
+	// Modules in a subdirectory of a repository are named after their directory.
+	if m.subdir != "" {
+		return path.Base(m.path)
+	}
 	return strings.TrimSuffix(path.Base(m.URL()), ".git")
 }
 
@@ -105,19 +153,81 @@ func (m GitModule) IsDirty() bool {
 }
 
 // IsAncestor returns whether ancestor is an ancestor of rev in the commit tree.
+// Shallow clones are deepened until the answer is known.
 func (m GitModule) IsAncestor(ancestor, rev string) bool {
-	_, _, err := m.tryRunGitCommand("merge-base", "--is-ancestor", ancestor, rev)
+	m.fetchCommit(ancestor)
+	return m.deepenUntil(func() bool {
+		_, _, err := m.tryRunGitCommand("merge-base", "--is-ancestor", ancestor, rev)
+		return err == nil
+	})
+}
+
+// Tags returns the commit hashes of all tags in the underlying repository, indexed by tag name.
+func (m GitModule) Tags() map[string]string {
+	// Fails if there are no tags at all.
+	stdout, _, err := m.tryRunGitCommand("show-ref", "--tags", "--dereference")
+	if err != nil {
+		return map[string]string{}
+	}
+	return parseTags(stdout)
+}
+
+// parseTags maps the names of the tags listed by 'git show-ref --tags --dereference' to the
+// hashes of the commits they point at.
+func parseTags(showRefOutput string) map[string]string {
+	tags := map[string]string{}
+	for _, line := range strings.Split(showRefOutput, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		// Annotated tags are listed twice, the dereferenced entry holds the commit hash.
+		name := strings.TrimSuffix(strings.TrimPrefix(fields[1], "refs/tags/"), "^{}")
+		tags[name] = fields[0]
+	}
+	return tags
+}
+
+// HasCommit reports whether the commit `hash` is available in the underlying repository.
+func (m GitModule) HasCommit(hash string) bool {
+	_, _, err := m.tryRunGitCommand("cat-file", "-e", hash+"^{commit}")
 	return err == nil
 }
 
+// ReadFile returns the content of the file at `filePath` (relative to the module root) as of
+// revision `rev`, and whether the file exists in that revision.
+func (m GitModule) ReadFile(rev, filePath string) ([]byte, bool) {
+	m.fetchCommit(rev)
+	stdout, _, err := m.tryRunGitCommand("show", fmt.Sprintf("%s:%s", rev, path.Join(m.subdir, filePath)))
+	if err != nil {
+		return nil, false
+	}
+	return []byte(stdout), true
+}
+
 // Fetch fetches changes from the default remote and reports whether any updates have been fetched.
 func (m GitModule) Fetch() bool {
 	if m.IsDirty() {
 		// If the module has uncommited changes, it does not match any version.
-		log.Warning("The module has uncommited changes. Not fetching any changes.\n")
+		m.logger.Warning("The module has uncommited changes. Not fetching any changes.\n")
+		return false
+	}
+
+	if ReadOnly {
+		m.logger.Debug("Not fetching any changes in read-only mode.\n")
 		return false
 	}
 
+	if Offline {
+		// The mirror is a local bare repository, so it can stand in for the remote.
+		if m.mirror == nil {
+			m.logger.Debug("Not fetching any changes in offline mode.\n")
+			return false
+		}
+		m.logger.Debug("Fetching changes from mirror '%s'.\n", m.mirror.path)
+		return len(m.runGitCommand("fetch", "--tags", m.mirror.path, "+refs/heads/*:refs/remotes/origin/*")) > 0
+	}
+
 	return len(m.runGitCommand("fetch", "--all", "--tags")) > 0
 }
 
@@ -129,6 +239,7 @@ func (m GitModule) Checkout(ref string) {
 		return
 	}
 
+	m.fetchCommit(ref)
 	m.runGitCommand("checkout", ref)
 }
 
@@ -137,11 +248,104 @@ func (m GitModule) Type() ModuleType {
 }
 
 // GetMergeBase returns the best common ancestor that could be used for a merge between the two given references.
+// Shallow clones are deepened until a common ancestor is found.
 func (m GitModule) GetMergeBase(revA, revB string) (string, error) {
-	stdout, _, err := m.tryRunGitCommand("merge-base", revA, revB)
+	m.fetchCommit(revA)
+	m.fetchCommit(revB)
+	var stdout string
+	var err error
+	m.deepenUntil(func() bool {
+		stdout, _, err = m.tryRunGitCommand("merge-base", revA, revB)
+		return err == nil
+	})
 	return stdout, err
 }
 
+// AheadBehind returns the number of commits that HEAD is ahead of and behind `ref`.
+func (m GitModule) AheadBehind(ref string) (int, int, error) {
+	stdout, _, err := m.tryRunGitCommand("rev-list", "--left-right", "--count", "HEAD..."+ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ahead, behind int
+	if _, err := fmt.Sscanf(stdout, "%d %d", &ahead, &behind); err != nil {
+		return 0, 0, err
+	}
+	return ahead, behind, nil
+}
+
+// Upstream returns the remote branch that the current branch tracks. It fails if HEAD is detached.
+func (m GitModule) Upstream() (string, error) {
+	stdout, _, err := m.tryRunGitCommand("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	return stdout, err
+}
+
+// UnpushedCommits returns the number of commits reachable from `revs` that are not on any remote branch.
+// `revs` can contain pseudo-revisions of git rev-list, such as `--branches`.
+func (m GitModule) UnpushedCommits(revs ...string) (int, error) {
+	args := append(append([]string{"rev-list", "--count"}, revs...), "--not", "--remotes")
+	stdout, _, err := m.tryRunGitCommand(args...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(stdout)
+}
+
+// CreateBranch creates the local branch `name` at `rev`.
+func (m GitModule) CreateBranch(name, rev string) error {
+	_, stderr, err := m.tryRunGitCommand("branch", name, rev)
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// isShallow reports whether the repository is a shallow clone.
+func (m GitModule) isShallow() bool {
+	stdout, _, err := m.tryRunGitCommand("rev-parse", "--is-shallow-repository")
+	return err == nil && stdout == "true"
+}
+
+// isPartial reports whether the repository is a partial clone that fetches objects on demand.
+func (m GitModule) isPartial() bool {
+	_, _, err := m.tryRunGitCommand("config", "--get", "remote.origin.promisor")
+	return err == nil
+}
+
+// fetchCommit fetches the commit `hash` from the remote if it is missing in a shallow or partial clone.
+// Other references are left alone, since they are kept up to date by `Fetch`.
+func (m GitModule) fetchCommit(hash string) {
+	if !commitHashRe.MatchString(hash) || m.HasCommit(hash) || Offline || !(m.isShallow() || m.isPartial()) {
+		return
+	}
+
+	m.logger.Debug("Fetching missing commit '%s'.\n", hash)
+	args := []string{"fetch", "origin", hash}
+	if m.isShallow() {
+		args = append(args, "--depth=1")
+	}
+	if _, _, err := m.tryRunGitCommand(args...); err != nil {
+		// Not all servers allow fetching commits by hash.
+		m.logger.Debug("Failed to fetch commit '%s': %s. Fetching full history instead.\n", hash, err)
+		m.deepenUntil(func() bool { return m.HasCommit(hash) })
+	}
+}
+
+// deepenUntil deepens a shallow clone step by step until `done` reports true or the full history
+// has been fetched. Returns the result of the last call to `done`.
+func (m GitModule) deepenUntil(done func() bool) bool {
+	for depth := 64; ; depth *= 2 {
+		if done() {
+			return true
+		}
+		if Offline || !m.isShallow() {
+			return false
+		}
+		m.logger.Log("Deepening shallow clone by %d commits.\n", depth)
+		m.runGitCommand("fetch", "--deepen="+strconv.Itoa(depth), "origin")
+	}
+}
+
 func (m GitModule) GetCommitTitle(revision string) (string, error) {
 	stdout, _, err := m.tryRunGitCommand("show", "--format=format:\"%s\"", "-s", revision)
 	return stdout, err
@@ -171,7 +375,7 @@ func (m GitModule) GetCommitsBetweenRefs(base, head string) ([]string, error) {
 func (m GitModule) runGitCommand(args ...string) string {
 	stdout, stderr, err := m.tryRunGitCommand(args...)
 	if err != nil {
-		log.Fatal("Failed to run git command 'git %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
+		m.logger.Fatal("Failed to run git command 'git %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
 	}
 	return stdout
 }
@@ -181,11 +385,16 @@ func (m GitModule) runGitCommand(args ...string) string {
 func (m GitModule) tryRunGitCommand(args ...string) (string, string, error) {
 	stderr := bytes.Buffer{}
 	stdout := bytes.Buffer{}
-	log.Debug("Running git command: git %s\n", strings.Join(args, " "))
+	m.logger.Debug("Running git command: git %s\n", strings.Join(args, " "))
 	cmd := exec.Command("git", args...)
+	cmd.Env = gitEnvironment()
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	cmd.Dir = m.path
+	if m.repoPath != "" {
+		// The subdirectory might not exist in the current revision.
+		cmd.Dir = m.repoPath
+	}
 	err := cmd.Run()
 	return strings.TrimSuffix(stdout.String(), "\n"), strings.TrimSuffix(stderr.String(), "\n"), err
 }
@@ -193,16 +402,40 @@ func (m GitModule) tryRunGitCommand(args ...string) (string, string, error) {
 // Clones a module from the given url at the specfied path location. If asMirror is passed, then a
 // mirror is created instead of a regular git repository.
 // If the git module has a mirror assigned, it will be used as the reference for the new git repository.
-func (m GitModule) clone(url string, asMirror bool) error {
+// Shallow and partial clones are created according to `options`.
+func (m GitModule) clone(url string, asMirror bool, options CloneOptions) error {
 	var err error
 	if asMirror {
-		log.Debug("Cloning '%s' as mirror '%s'.\n", url, m.path)
+		m.logger.Debug("Cloning '%s' as mirror '%s'.\n", url, m.path)
 		_, _, err = m.tryRunGitCommand("clone", "--mirror", url, m.path)
+	} else if Offline {
+		if m.mirror == nil {
+			return fmt.Errorf("'%s' is not available in the local mirror", url)
+		}
+		// Submodules are not cloned, since they might not be available in the mirror.
+		m.logger.Log("Cloning '%s' from mirror '%s'.\n", url, m.mirror.path)
+		_, _, err = m.tryRunGitCommand("clone", m.mirror.path, m.path)
+		if err == nil {
+			_, _, err = m.tryRunGitCommand("remote", "set-url", "origin", url)
+		}
 	} else if m.mirror != nil {
-		log.Log("Cloning '%s' using mirror '%s'.\n", url, m.mirror.path)
+		m.logger.Log("Cloning '%s' using mirror '%s'.\n", url, m.mirror.path)
 		_, _, err = m.tryRunGitCommand("clone", "--recursive", "--reference", m.mirror.path, url, m.path)
+	} else if options.IsSet() {
+		args := []string{"clone", "--recursive", "--no-single-branch"}
+		if options.Depth > 0 {
+			m.logger.Log("Cloning '%s' with depth %d.\n", url, options.Depth)
+			args = append(args, fmt.Sprintf("--depth=%d", options.Depth), "--shallow-submodules")
+		} else {
+			m.logger.Log("Cloning '%s'.\n", url)
+		}
+		if options.Filter != "" {
+			m.logger.Log("Using filter '%s'.\n", options.Filter)
+			args = append(args, "--filter="+options.Filter)
+		}
+		_, _, err = m.tryRunGitCommand(append(args, url, m.path)...)
 	} else {
-		log.Log("Cloning '%s'.\n", url)
+		m.logger.Log("Cloning '%s'.\n", url)
 		_, _, err = m.tryRunGitCommand("clone", "--recursive", url, m.path)
 	}
 	if err != nil {
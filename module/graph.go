@@ -0,0 +1,144 @@
+package module
+
+import (
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// DependencyEdge is a dependency declared in the MODULE file of module `From` on module `To`.
+// For the workspace module in lock file mode, the hash is taken from the MODULE.lock file.
+type DependencyEdge struct {
+	From string
+	To   string
+	Dependency
+}
+
+// DependencyGraph describes the dependencies between all modules in the workspace as declared in
+// the MODULE files of the checked out modules.
+type DependencyGraph struct {
+	Root    string
+	Modules util.OrderedMap[string, Module]
+	Edges   []DependencyEdge
+}
+
+// ReadDependencyGraph reads the MODULE files of the workspace module and all modules in DEPS/.
+func ReadDependencyGraph(workspaceRoot string) DependencyGraph {
+	graph := DependencyGraph{
+		Root:    OpenModule(workspaceRoot).Name(),
+		Modules: GetAllModules(workspaceRoot),
+	}
+
+	workspaceModuleFile := ReadModuleFile(workspaceRoot)
+	graph.addEdges(graph.Root, workspaceModuleFile)
+	if workspaceModuleFile.UseLockFile {
+		lockFile := ReadLockFile(workspaceRoot)
+		for idx, edge := range graph.Edges {
+			if locked, isLocked := lockFile.Dependencies[edge.To]; isLocked && edge.Hash == "" && locked.URL == edge.URL {
+				graph.Edges[idx].Hash = locked.Hash
+			}
+		}
+	}
+
+	for _, entry := range graph.Modules.Entries() {
+		if entry.Key == graph.Root {
+			continue
+		}
+		graph.addEdges(entry.Key, ReadModuleFile(entry.Value.RootPath()))
+	}
+	return graph
+}
+
+func (g *DependencyGraph) addEdges(from string, moduleFile ModuleFile) {
+	for _, entry := range util.OrderedEntries(moduleFile.Dependencies) {
+		g.Edges = append(g.Edges, DependencyEdge{from, entry.Key, entry.Value})
+	}
+}
+
+// EdgesFrom returns the dependencies of module `name`.
+func (g DependencyGraph) EdgesFrom(name string) []DependencyEdge {
+	edges := []DependencyEdge{}
+	for _, edge := range g.Edges {
+		if edge.From == name {
+			edges = append(edges, edge)
+		}
+	}
+	return edges
+}
+
+// MaxCountedPaths is the number of dependency paths after which Paths stops counting.
+const MaxCountedPaths = 10000
+
+// Paths returns the first `limit` dependency paths from the workspace module to module `name`, and
+// the number of all paths, counting at most MaxCountedPaths of them.
+// Paths never visit a module twice, so cycles are not followed.
+func (g DependencyGraph) Paths(name string, limit int) ([][]DependencyEdge, int) {
+	// Only modules that depend on `name` lead to a path. Skipping all other modules keeps the
+	// search proportional to the number of paths.
+	leadsToName := map[string]bool{}
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range g.Edges {
+			if edge.To == current && !leadsToName[edge.From] {
+				leadsToName[edge.From] = true
+				queue = append(queue, edge.From)
+			}
+		}
+	}
+
+	paths := [][]DependencyEdge{}
+	count := 0
+	visited := map[string]bool{g.Root: true}
+	current := []DependencyEdge{}
+
+	var visit func(from string)
+	visit = func(from string) {
+		for _, edge := range g.EdgesFrom(from) {
+			if count >= MaxCountedPaths {
+				return
+			}
+			if visited[edge.To] || edge.To != name && !leadsToName[edge.To] {
+				continue
+			}
+			current = append(current, edge)
+			if edge.To == name {
+				if count < limit {
+					paths = append(paths, append([]DependencyEdge{}, current...))
+				}
+				count++
+			} else {
+				visited[edge.To] = true
+				visit(edge.To)
+				visited[edge.To] = false
+			}
+			current = current[:len(current)-1]
+		}
+	}
+	visit(g.Root)
+	return paths, count
+}
+
+// Reaches reports whether module `to` is a direct or transitive dependency of module `from`.
+func (g DependencyGraph) Reaches(from, to string) bool {
+	visited := map[string]bool{}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, edge := range g.EdgesFrom(current) {
+			if edge.To == to {
+				return true
+			}
+			if !visited[edge.To] {
+				visited[edge.To] = true
+				queue = append(queue, edge.To)
+			}
+		}
+	}
+	return false
+}
+
+// IsCycle reports whether the edge is part of a dependency cycle.
+func (g DependencyGraph) IsCycle(edge DependencyEdge) bool {
+	return edge.From == edge.To || g.Reaches(edge.To, edge.From)
+}
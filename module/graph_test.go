@@ -0,0 +1,63 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testGraph(edges ...string) DependencyGraph {
+	graph := DependencyGraph{Root: "root"}
+	for _, edge := range edges {
+		from, to, _ := strings.Cut(edge, "->")
+		graph.Edges = append(graph.Edges, DependencyEdge{From: from, To: to})
+	}
+	return graph
+}
+
+func formatPath(path []DependencyEdge) string {
+	modules := []string{path[0].From}
+	for _, edge := range path {
+		modules = append(modules, edge.To)
+	}
+	return strings.Join(modules, "->")
+}
+
+func TestPaths(t *testing.T) {
+	graph := testGraph("root->a", "root->b", "a->c", "b->c", "c->d", "b->d", "d->c", "root->e")
+	expected := []string{"root->a->c->d", "root->b->c->d", "root->b->d"}
+
+	paths, count := graph.Paths("d", 10)
+	if len(paths) != len(expected) || count != len(expected) {
+		t.Fatalf("Paths(%q) returned %d of %d paths; expected %d", "d", len(paths), count, len(expected))
+	}
+	for idx, path := range paths {
+		if formatPath(path) != expected[idx] {
+			t.Errorf("Paths(%q)[%d] = %s; expected %s", "d", idx, formatPath(path), expected[idx])
+		}
+	}
+	if paths, count := graph.Paths("d", 1); len(paths) != 1 || count != len(expected) {
+		t.Errorf("Paths(%q) with limit 1 returned %d of %d paths; expected 1 of %d", "d", len(paths), count, len(expected))
+	}
+	if paths, count := graph.Paths("missing", 10); len(paths) != 0 || count != 0 {
+		t.Errorf("Paths(%q) returned %d of %d paths; expected none", "missing", len(paths), count)
+	}
+}
+
+func TestPathsOfDiamonds(t *testing.T) {
+	// A chain of 30 diamonds has 2^30 paths to its end.
+	edges := []string{}
+	for idx := 0; idx < 30; idx++ {
+		from, to := fmt.Sprintf("m%d", idx), fmt.Sprintf("m%d", idx+1)
+		if idx == 0 {
+			from = "root"
+		}
+		edges = append(edges, from+"->"+to+"a", from+"->"+to+"b", to+"a->"+to, to+"b->"+to)
+	}
+	graph := testGraph(edges...)
+
+	paths, count := graph.Paths("m30", 2)
+	if len(paths) != 2 || len(paths[0]) != 60 || count != MaxCountedPaths {
+		t.Errorf("Paths(%q) returned %d of %d paths; expected 2 paths of length 60 of %d", "m30", len(paths), count, MaxCountedPaths)
+	}
+}
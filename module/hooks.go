@@ -0,0 +1,62 @@
+package module
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/log"
+)
+
+const defaultHookTimeout = time.Minute
+
+const (
+	PreSyncHook      = "pre-sync"
+	PostCheckoutHook = "post-checkout"
+	PostSyncHook     = "post-sync"
+)
+
+func (h Hook) String() string {
+	if h.Go != "" {
+		return "go run " + h.Go
+	}
+	return strings.Join(h.Command, " ")
+}
+
+// RunHook runs `hook` of module `name` in `modulePath` and passes `state` to it on stdin.
+// The hook runs with the environment of the setup policy. It fails if the hook fails or times out.
+func RunHook(name, modulePath, event string, hook Hook, state []byte, policy SetupPolicy) {
+	var cmd *exec.Cmd
+	if hook.Go != "" && len(hook.Command) == 0 {
+		cmd = exec.Command("go", "run", hook.Go)
+	} else if hook.Go == "" && len(hook.Command) > 0 {
+		cmd = exec.Command(hook.Command[0], hook.Command[1:]...)
+	} else {
+		log.Fatal("Each %s hook of '%s' must set either 'go' or 'command'.\n", event, name)
+	}
+
+	timeout := defaultHookTimeout
+	if hook.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(hook.Timeout); err != nil || timeout <= 0 {
+			log.Fatal("Invalid timeout '%s' of %s hook '%s' of '%s'. Use a positive duration like '30s'.\n", hook.Timeout, event, hook, name)
+		}
+	}
+
+	log.Log("Running %s hook '%s' of '%s'.\n", event, hook, name)
+	cmd.Dir = modulePath
+	cmd.Env = append(policy.environment(name, modulePath), "DBT_HOOK="+event)
+	cmd.Stdin = bytes.NewReader(state)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+
+	timedOut, err := runWithTimeout(cmd, timeout)
+	if timedOut {
+		log.Fatal("The %s hook '%s' of '%s' timed out after %s.\n", event, hook, name, timeout)
+	}
+	if err != nil {
+		log.Fatal("The %s hook '%s' of '%s' failed: %s.\n", event, hook, name, err)
+	}
+}
@@ -2,6 +2,7 @@ package module
 
 import (
 	"bytes"
+	"fmt"
 	"os/exec"
 	"path"
 	"strings"
@@ -13,12 +14,14 @@ import (
 // JujutsuModule is a module backed by a git repository.
 type JujutsuModule struct {
 	path string
+	// logger prints the messages of cloning and fetching the module, see CloneOptions.Logger.
+	logger *log.Logger
 }
 
 // createJujutsuModule creates a new JujutsuModule in the given `modulePath`
 // by cloning the repository from `url`. Uses a git backend
-func createJujutsuModule(modulePath, url string) (Module, error) {
-	mod := JujutsuModule{modulePath}
+func createJujutsuModule(modulePath, url string, logger *log.Logger) (Module, error) {
+	mod := JujutsuModule{path: modulePath, logger: logger}
 	util.MkdirAll(modulePath)
 	if err := mod.clone(url); err != nil {
 		return nil, err
@@ -62,11 +65,42 @@ func (m JujutsuModule) IsAncestor(ancestor, rev string) bool {
 	return err == nil
 }
 
+// Tags returns the commit hashes of all tags in the underlying repository, indexed by tag name.
+func (m JujutsuModule) Tags() map[string]string {
+	// Fails if there are no tags at all.
+	stdout, _, err := m.tryRunGitCommand("show-ref", "--tags", "--dereference")
+	if err != nil {
+		return map[string]string{}
+	}
+	return parseTags(stdout)
+}
+
+// HasCommit reports whether the commit `hash` is available in the underlying repository.
+func (m JujutsuModule) HasCommit(hash string) bool {
+	_, _, err := m.tryRunGitCommand("cat-file", "-e", hash+"^{commit}")
+	return err == nil
+}
+
+// ReadFile returns the content of the file at `filePath` (relative to the module root) as of
+// revision `rev`, and whether the file exists in that revision.
+func (m JujutsuModule) ReadFile(rev, filePath string) ([]byte, bool) {
+	stdout, _, err := m.tryRunGitCommand("show", fmt.Sprintf("%s:%s", rev, filePath))
+	if err != nil {
+		return nil, false
+	}
+	return []byte(stdout), true
+}
+
 // Fetch fetches changes from the default remote and reports whether any updates have been fetched.
 func (m JujutsuModule) Fetch() bool {
 	if m.IsDirty() {
 		// If the module has uncommited changes, it does not match any version.
-		log.Warning("The module has uncommited changes. Not fetching any changes.\n")
+		m.logger.Warning("The module has uncommited changes. Not fetching any changes.\n")
+		return false
+	}
+
+	if Offline || ReadOnly {
+		m.logger.Debug("Not fetching any changes in offline or read-only mode.\n")
 		return false
 	}
 
@@ -118,7 +152,7 @@ func (m JujutsuModule) GetCommitsBetweenRefs(base, head string) ([]string, error
 func (m JujutsuModule) runJjCommand(args ...string) string {
 	stdout, stderr, err := m.tryRunJjCommand(args...)
 	if err != nil {
-		log.Fatal("Failed to run jj command 'jj %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
+		m.logger.Fatal("Failed to run jj command 'jj %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
 	}
 	return stdout
 }
@@ -128,8 +162,9 @@ func (m JujutsuModule) runJjCommand(args ...string) string {
 func (m JujutsuModule) tryRunJjCommand(args ...string) (string, string, error) {
 	stderr := bytes.Buffer{}
 	stdout := bytes.Buffer{}
-	log.Debug("Running jj command: jj %s\n", strings.Join(args, " "))
+	m.logger.Debug("Running jj command: jj %s\n", strings.Join(args, " "))
 	cmd := exec.Command("jj", args...)
+	cmd.Env = gitEnvironment()
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	cmd.Dir = m.path
@@ -142,7 +177,7 @@ func (m JujutsuModule) tryRunJjCommand(args ...string) (string, string, error) {
 func (m JujutsuModule) runGitCommand(args ...string) string {
 	stdout, stderr, err := m.tryRunGitCommand(args...)
 	if err != nil {
-		log.Fatal("Failed to run git command 'git %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
+		m.logger.Fatal("Failed to run git command 'git %s':\n%s\n%s\n%s\n", strings.Join(args, " "), stderr, stdout, err)
 	}
 	return stdout
 }
@@ -152,8 +187,9 @@ func (m JujutsuModule) runGitCommand(args ...string) string {
 func (m JujutsuModule) tryRunGitCommand(args ...string) (string, string, error) {
 	stderr := bytes.Buffer{}
 	stdout := bytes.Buffer{}
-	log.Debug("Running git command: git %s\n", strings.Join(args, " "))
+	m.logger.Debug("Running git command: git %s\n", strings.Join(args, " "))
 	cmd := exec.Command("git", args...)
+	cmd.Env = gitEnvironment()
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	gitRepoPath := m.locateGitRepo()
@@ -168,8 +204,12 @@ func (m JujutsuModule) locateGitRepo() string {
 
 // Clones a module from the given url at the specfied path location.
 func (m JujutsuModule) clone(url string) error {
+	if Offline {
+		return fmt.Errorf("jj modules can not be cloned in offline mode")
+	}
+
 	var err error
-	log.Log("Cloning '%s'.\n", url)
+	m.logger.Log("Cloning '%s'.\n", url)
 	_, _, err = m.tryRunJjCommand("git", "clone", url, m.path)
 	if err != nil {
 		// Leave clean state so that the operation can be retried
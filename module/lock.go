@@ -0,0 +1,52 @@
+package module
+
+import (
+	"path"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// LockedDependency is a dependency hash resolved by 'dbt sync'.
+type LockedDependency struct {
+	URL     string
+	Version string
+	Hash    string
+}
+
+// LockFile stores the resolved hashes of all direct and transitive dependencies of a workspace.
+type LockFile struct {
+	Version      uint
+	Dependencies map[string]LockedDependency
+}
+
+// ReadLockFile reads the MODULE.lock file of a module. An empty lock file is returned if the
+// module has no MODULE.lock file.
+func ReadLockFile(modulePath string) LockFile {
+	lockFilePath := path.Join(modulePath, util.LockFileName)
+	if !util.FileExists(lockFilePath) {
+		log.Debug("Module has no %s file.\n", util.LockFileName)
+		return LockFile{
+			Version:      util.LockSyntaxVersion,
+			Dependencies: map[string]LockedDependency{},
+		}
+	}
+
+	lockFile := LockFile{}
+	util.ReadYaml(lockFilePath, &lockFile)
+	if lockFile.Version != util.LockSyntaxVersion {
+		log.Fatal("%s file has unknown syntax version %d. It is either a mistake in the file or a newer version of dbt is required.\n", util.LockFileName, lockFile.Version)
+	}
+
+	// YAML decoding produces `nil` maps for keys without entries.
+	if lockFile.Dependencies == nil {
+		lockFile.Dependencies = map[string]LockedDependency{}
+	}
+	return lockFile
+}
+
+// WriteLockFile serializes and writes the resolved dependency hashes to a MODULE.lock file.
+func WriteLockFile(modulePath string, lockFile LockFile) {
+	lockFile.Version = util.LockSyntaxVersion
+	util.WriteYaml(path.Join(modulePath, util.LockFileName), lockFile)
+}
@@ -0,0 +1,147 @@
+package module
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// runInParallel runs `f` twice at the same time, like two jobs of 'dbt sync -j 2' cloning
+// dependencies with the same URL, and returns their errors. Each job must see a complete mirror.
+func runInParallel(f func() error) []error {
+	errs := make([]error, 2)
+	wg := sync.WaitGroup{}
+	for idx := range errs {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = f()
+		}(idx)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestCreateGitMirrorInParallel(t *testing.T) {
+	repoPath := path.Join(t.TempDir(), "repo")
+	for _, args := range [][]string{
+		{"init", "-q", repoPath},
+		{"-C", repoPath, "-c", "user.name=dbt", "-c", "user.email=dbt@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s\n%s", args, err, output)
+		}
+	}
+
+	mirrorPath := path.Join(t.TempDir(), "mirror")
+	for idx, err := range runInParallel(func() error {
+		if _, err := openOrCreateGitMirror(repoPath, mirrorPath); err != nil {
+			return err
+		}
+		if _, _, err := (GitModule{path: mirrorPath}).tryRunGitCommand("rev-parse", "--verify", "HEAD"); err != nil {
+			return fmt.Errorf("the mirror is incomplete: %s", err)
+		}
+		return nil
+	}) {
+		if err != nil {
+			t.Errorf("job %d failed to create the mirror: %s", idx, err)
+		}
+	}
+}
+
+func TestCreateTarMirrorInParallel(t *testing.T) {
+	archive := writeTar(t, []archiveEntry{dir("root"), file("root/a.txt", "a")})
+	archive.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, archive.Name())
+	}))
+	defer server.Close()
+
+	mirrorPath := path.Join(t.TempDir(), "mirror")
+	for idx, err := range runInParallel(func() error {
+		if _, err := openOrCreateTarMirror(server.URL+"/archive.tar", mirrorPath); err != nil {
+			return err
+		}
+		if !util.FileExists(path.Join(mirrorPath, tarMetadataFileName)) || !util.FileExists(path.Join(mirrorPath, "a.txt")) {
+			return fmt.Errorf("the mirror is incomplete")
+		}
+		return nil
+	}) {
+		if err != nil {
+			t.Errorf("job %d failed to create the mirror: %s", idx, err)
+		}
+	}
+}
+
+// archiveServer serves an archive, which can be replaced, and counts the requests.
+type archiveServer struct {
+	archive  string
+	requests int
+}
+
+func (s *archiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests++
+	http.ServeFile(w, r, s.archive)
+}
+
+func (s *archiveServer) serve(t *testing.T, entries []archiveEntry) {
+	archive := writeTar(t, entries)
+	archive.Close()
+	s.archive = archive.Name()
+}
+
+func TestCloneTarUpdatesStaleMirror(t *testing.T) {
+	archives := &archiveServer{}
+	archives.serve(t, []archiveEntry{dir("root"), file("root/a.txt", "old")})
+	server := httptest.NewServer(archives)
+	defer server.Close()
+	url := server.URL + "/archive.tar"
+
+	mirrorPath := path.Join(t.TempDir(), "mirror")
+	mirror, err := openOrCreateTarMirror(url, mirrorPath)
+	if err != nil {
+		t.Fatalf("failed to create the mirror: %s", err)
+	}
+	// The mirror has been downloaded by an earlier invocation of dbt.
+	currentMirrors.Delete(mirrorPath)
+	archives.serve(t, []archiveEntry{dir("root"), file("root/a.txt", "new")})
+
+	modulePath := path.Join(t.TempDir(), "module")
+	if err := (TarModule{path: modulePath, mirror: mirror}).clone(url, ""); err != nil {
+		t.Fatalf("failed to clone the module: %s", err)
+	}
+	for _, p := range []string{modulePath, mirrorPath} {
+		if content, _ := os.ReadFile(path.Join(p, "a.txt")); string(content) != "new" {
+			t.Errorf("'%s' has content '%s' instead of the latest version of the archive", p, content)
+		}
+	}
+}
+
+func TestCloneTarDoesNotDownloadCurrentMirrorAgain(t *testing.T) {
+	archives := &archiveServer{}
+	archives.serve(t, []archiveEntry{dir("root"), file("root/a.txt", "a")})
+	server := httptest.NewServer(archives)
+	defer server.Close()
+	url := server.URL + "/archive.tar"
+
+	mirror, err := openOrCreateTarMirror(url, path.Join(t.TempDir(), "mirror"))
+	if err != nil {
+		t.Fatalf("failed to create the mirror: %s", err)
+	}
+	if err := (TarModule{path: path.Join(t.TempDir(), "updated"), mirror: mirror}).clone(url, ""); err != nil {
+		t.Errorf("failed to clone the module: %s", err)
+	}
+	if err := (TarModule{path: path.Join(t.TempDir(), "pinned"), mirror: mirror}).clone(url, "0000"); err == nil {
+		t.Errorf("cloning the module with a different pinned hash did not fail")
+	}
+	if archives.requests != 1 {
+		t.Errorf("the archive has been downloaded %d times instead of once", archives.requests)
+	}
+}
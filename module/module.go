@@ -1,14 +1,12 @@
 package module
 
 import (
-	"context"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/daedaleanai/dbt/v3/log"
 	"github.com/daedaleanai/dbt/v3/util"
@@ -33,6 +31,24 @@ type GoModule struct {
 	Deps []string
 }
 
+// Offline disables all network access. Modules are then only cloned and fetched from the local mirror.
+var Offline bool
+
+// ReadOnly leaves the modules and the mirror unchanged, as needed by a dry run: modules are not fetched
+// and missing mirrors are not created. Hashes are resolved from the refs that are present already.
+var ReadOnly bool
+
+// mirrorLocks holds a *sync.Mutex for every mirror path, which serializes creating, reading and
+// updating the mirror when modules are cloned in parallel.
+var mirrorLocks sync.Map
+
+// lockMirror locks the mirror at `mirrorPath` and returns the function that unlocks it.
+func lockMirror(mirrorPath string) func() {
+	mutex, _ := mirrorLocks.LoadOrStore(mirrorPath, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+	return mutex.(*sync.Mutex).Unlock
+}
+
 // Module represents a checked-out module.
 type Module interface {
 	Name() string
@@ -42,6 +58,9 @@ type Module interface {
 	RevParse(rev string) string
 	IsDirty() bool
 	IsAncestor(ancestor, rev string) bool
+	Tags() map[string]string
+	HasCommit(hash string) bool
+	ReadFile(rev, filePath string) ([]byte, bool)
 
 	Fetch() bool
 	Checkout(hash string)
@@ -329,6 +348,10 @@ func OpenModule(modulePath string) Module {
 		return TarModule{path: modulePath, mirror: mirror}
 	}
 
+	if module, ok := openSubdirModule(modulePath); ok {
+		return module
+	}
+
 	log.Fatal("Module appears to be broken. Remove the module directory and rerun 'dbt sync'.\n")
 	return nil
 }
@@ -348,17 +371,18 @@ func (t ModuleType) String() string {
 	case TarGzModuleType:
 		return "tar.gz"
 	case JujutsuModuleType:
-		return "tar.gz"
+		return "jj"
 	}
 
-	log.Fatal("Invalid module type: %s\n", t)
+	log.Fatal("Invalid module type: %d\n", uint(t))
 	return ""
 }
 
 func ParseModuleTypeString(str string) (ModuleType, bool) {
 	if str == "git" {
 		return GitModuleType, true
-	} else if str == "tar.gz" {
+	} else if str == "tar.gz" || str == "archive" {
+		// All archive formats are handled by TarModules.
 		return TarGzModuleType, true
 	} else if str == "jj" {
 		return JujutsuModuleType, true
@@ -380,8 +404,8 @@ func DetermineModuleType(url, moduleTypeString string) ModuleType {
 		log.Debug("Module URL ends in '.git'. Trying to create a new git module.\n")
 		return GitModuleType
 	}
-	if strings.HasSuffix(url, ".tar.gz") {
-		log.Debug("Module URL ends in '.tar.gz'. Trying to create a new TarModule.\n")
+	if IsArchiveUrl(url) {
+		log.Debug("Module URL has the extension of an archive. Trying to create a new TarModule.\n")
 		return TarGzModuleType
 	}
 	if strings.HasSuffix(url, ".jj") {
@@ -393,78 +417,92 @@ func DetermineModuleType(url, moduleTypeString string) ModuleType {
 	return GitModuleType // Just because golang is not clever enough to notice that this is unreachable.
 }
 
-// OpenOrCreateModule tries to open the module in `modulePath`. If the `modulePath` directory does
-// not yet exists, it tries to create a new module by cloning / downloading the module from `url`.
-func OpenOrCreateModule(modulePath string, url string, moduleTypeString string, expectedHash string) Module {
-	log.Debug("Opening or creating module '%s' from url '%s'.\n", modulePath, url)
+// OpenOrCloneModule tries to open the module in `modulePath`. If the `modulePath` directory does
+// not yet exist, it creates a new module by cloning / downloading the module from `url`. It never
+// runs the SETUP.go file of the module, but reports whether the module has been newly created, in
+// which case the caller is responsible for setting it up once the right version is checked out. Git modules are cloned
+// according to `options`.
+func OpenOrCloneModule(modulePath string, url string, moduleTypeString string, options CloneOptions) (Module, bool) {
+	options.Logger.Debug("Opening or creating module '%s' from url '%s'.\n", modulePath, url)
+	if options.Subdir != "" {
+		return openOrCloneSubdirModule(modulePath, url, moduleTypeString, options)
+	}
+	if IsSubdirLink(modulePath) {
+		options.Logger.Debug("Module is no longer a subdirectory of a repository. Removing symlink '%s'.\n", modulePath)
+		os.Remove(modulePath)
+	}
+
 	if util.DirExists(modulePath) {
-		log.Debug("Module directory exists.\n")
-		return OpenModule(modulePath)
+		options.Logger.Debug("Module directory exists.\n")
+		return withLogger(OpenModule(modulePath), options.Logger), false
 	}
 
-	log.Debug("Module directory does not exists.\n")
+	options.Logger.Debug("Module directory does not exists.\n")
 
 	moduleType := DetermineModuleType(url, moduleTypeString)
+	if moduleType != GitModuleType && options.IsSet() {
+		options.Logger.Warning("Depth and filter are only supported for git dependencies. Ignoring them.\n")
+	}
 
 	if moduleType == GitModuleType {
-		module, err := CreateGitModule(modulePath, url)
+		module, err := createGitModule(modulePath, url, options)
 		if err != nil {
 			os.RemoveAll(modulePath)
-			log.Fatal("Failed to create git module: %s.\n", err)
-		}
-		if module.Head() == expectedHash {
-			SetupModule(modulePath)
+			options.Logger.Fatal("Failed to create git module: %s.\n", err)
 		}
-		return module
+		return module, true
 	} else if moduleType == TarGzModuleType {
-		module, err := createTarModule(modulePath, url)
+		module, err := createTarModule(modulePath, url, options.Hash, options.Logger)
 		if err != nil {
 			os.RemoveAll(modulePath)
-			log.Fatal("Failed to create tar module: %s.\n", err)
+			options.Logger.Fatal("Failed to create tar module: %s.\n", err)
 		}
-		SetupModule(modulePath)
-		return module
+		return module, true
 	} else if moduleType == JujutsuModuleType {
-		module, err := createJujutsuModule(modulePath, url)
+		module, err := createJujutsuModule(modulePath, url, options.Logger)
 		if err != nil {
 			os.RemoveAll(modulePath)
-			log.Fatal("Failed to create jj module: %s.\n", err)
+			options.Logger.Fatal("Failed to create jj module: %s.\n", err)
 		}
-		if module.Head() == expectedHash {
-			SetupModule(modulePath)
-		}
-		return module
+		return module, true
 	}
 
-	log.Fatal("Unhandled module type %v\n", moduleType)
-	return nil
+	options.Logger.Fatal("Unhandled module type %v\n", moduleType)
+	return nil, false
 }
 
-// SetupModule runs the SETUP.go file in the root directory of `mod` (it if exists).
-func SetupModule(modulePath string) {
-	setupFilePath := path.Join(modulePath, setupFileName)
-	if !util.FileExists(setupFilePath) {
-		log.Debug("Module has no %s file. Nothing to do.\n", setupFileName)
-		return
-	}
-
-	log.Debug("Running 'go run %s'.\n", setupFilePath)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cmd := exec.Command("go", "run", setupFilePath)
-	cmd.Dir = modulePath
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	err := cmd.Run()
+// withLogger returns `mod` with the logger that prints the messages of cloning and fetching it.
+func withLogger(mod Module, logger *log.Logger) Module {
+	switch mod := mod.(type) {
+	case GitModule:
+		mod.logger = logger
+		return mod
+	case TarModule:
+		mod.logger = logger
+		return mod
+	case JujutsuModule:
+		mod.logger = logger
+		return mod
+	}
+	return mod
+}
 
-	if ctx.Err() == context.DeadlineExceeded {
-		log.Fatal("Running %s timed out: %s.\n: %s.\n", setupFileName, ctx.Err())
+// IsAvailableOffline reports whether the module in `modulePath` can be opened or cloned without
+// network access, i.e., whether it exists on disk or in the local mirror.
+func IsAvailableOffline(modulePath string, url string, moduleTypeString string) bool {
+	if util.DirExists(modulePath) || IsSubdirLink(modulePath) {
+		return true
 	}
-	if err != nil {
-		log.Fatal("Running %s failed: %s.\n", setupFileName, err)
+
+	switch DetermineModuleType(url, moduleTypeString) {
+	case GitModuleType:
+		mirrorPath := gitMirrorPath(url)
+		return mirrorPath != "" && util.DirExists(mirrorPath)
+	case TarGzModuleType:
+		mirrorPath := tarMirrorPath(url)
+		return mirrorPath != "" && util.FileExists(path.Join(mirrorPath, tarMetadataFileName))
 	}
-	log.Success("Module is set up.\n")
+	return false
 }
 
 // GetAllModules return all the names and modules in the workspace
@@ -481,6 +519,9 @@ func GetAllModules(workspaceRoot string) util.OrderedMap[string, Module] {
 	modules := map[string]Module{}
 
 	for _, file := range files {
+		if file.Name() == util.SubdirReposDirName || file.Name() == util.TrashDirName {
+			continue
+		}
 		if file.IsDir() || (file.Mode()&os.ModeSymlink) == os.ModeSymlink {
 			modules[file.Name()] = OpenModule(path.Join(depsDir, file.Name()))
 		}
@@ -0,0 +1,12 @@
+package module
+
+import "testing"
+
+func TestModuleTypeString(t *testing.T) {
+	// The names are used by 'dbt status', 'dbt dep graph' and 'dbt foreach --type'.
+	for _, moduleType := range []ModuleType{GitModuleType, TarGzModuleType, JujutsuModuleType} {
+		if parsed, ok := ParseModuleTypeString(moduleType.String()); !ok || parsed != moduleType {
+			t.Errorf("ParseModuleTypeString(%q) = %d, %t; expected %d", moduleType.String(), parsed, ok, moduleType)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package module
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// systemCABundles are the usual locations of the CA bundle of the system.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+var gitEnv []string
+var gitEnvOnce sync.Once
+
+// proxySettings are the proxies of the user configuration, or of the environment if they are not configured.
+type proxySettings struct {
+	httpProxy  string
+	httpsProxy string
+	noProxy    string
+}
+
+func getenvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func readProxySettings() proxySettings {
+	httpConfig := config.GetConfig().HTTP
+	settings := proxySettings{
+		httpProxy:  getenvAny("HTTP_PROXY", "http_proxy"),
+		httpsProxy: getenvAny("HTTPS_PROXY", "https_proxy"),
+		noProxy:    getenvAny("NO_PROXY", "no_proxy"),
+	}
+	if httpConfig.HTTPProxy != "" {
+		settings.httpProxy = httpConfig.HTTPProxy
+	}
+	if httpConfig.HTTPSProxy != "" {
+		settings.httpsProxy = httpConfig.HTTPSProxy
+	}
+	if httpConfig.NoProxy != "" {
+		settings.noProxy = httpConfig.NoProxy
+	}
+	return settings
+}
+
+// proxyForRequest returns the proxy for `request`, or nil if it is sent directly.
+func (s proxySettings) proxyForRequest(request *http.Request) (*url.URL, error) {
+	proxy := s.httpProxy
+	if request.URL.Scheme == "https" {
+		proxy = s.httpsProxy
+	}
+	if proxy == "" || !s.useProxy(request.URL) {
+		return nil, nil
+	}
+
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+		// Like curl, proxies without a scheme are http proxies.
+		proxyUrl, err = url.Parse("http://" + proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL for %s requests", request.URL.Scheme)
+		}
+	}
+	return proxyUrl, nil
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// useProxy reports whether requests to `requestUrl` go through a proxy. Like the no_proxy environment
+// variable, the no-proxy setting lists hosts and domains (optionally with a port), IP addresses and
+// IP ranges in CIDR notation, or '*' for all hosts. Requests to localhost are never sent to a proxy.
+func (s proxySettings) useProxy(requestUrl *url.URL) bool {
+	host := strings.ToLower(requestUrl.Hostname())
+	port := requestUrl.Port()
+	if port == "" {
+		port = defaultPort(requestUrl.Scheme)
+	}
+	ip := net.ParseIP(host)
+	if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		return false
+	}
+
+	for _, entry := range strings.Split(strings.ToLower(s.noProxy), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return false
+		}
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && ipNet.Contains(ip) {
+				return false
+			}
+			continue
+		}
+		if entryHost, entryPort, err := net.SplitHostPort(entry); err == nil {
+			if entryPort != port {
+				continue
+			}
+			entry = entryHost
+		}
+		if entryIp := net.ParseIP(entry); entryIp != nil {
+			if ip != nil && entryIp.Equal(ip) {
+				return false
+			}
+			continue
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// readCABundles returns the content of the CA bundles in the user configuration.
+func readCABundles() [][]byte {
+	bundles := [][]byte{}
+	for _, bundlePath := range config.GetConfig().HTTP.CABundles {
+		bundle, err := os.ReadFile(bundlePath)
+		if err != nil {
+			log.Fatal("Failed to read CA bundle: %s.\n", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(bundle) {
+			log.Fatal("The CA bundle '%s' does not contain any PEM certificates.\n", bundlePath)
+		}
+		bundles = append(bundles, bundle)
+	}
+	return bundles
+}
+
+// rootCAs returns the CA certificates of the system and of the CA bundles in the user configuration,
+// or nil if there are no CA bundles and only the system's certificates are trusted.
+func rootCAs() *x509.CertPool {
+	bundles := readCABundles()
+	if len(bundles) == 0 {
+		return nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		log.Debug("Failed to load the CA certificates of the system: %s.\n", err)
+		pool = x509.NewCertPool()
+	}
+	for _, bundle := range bundles {
+		pool.AppendCertsFromPEM(bundle)
+	}
+	return pool
+}
+
+// combinedCABundle writes the CA bundle of the system and the CA bundles in the user configuration
+// to a single file for git, which only reads one CA bundle. Returns the path of the file, or an
+// empty string if there are no CA bundles.
+func combinedCABundle() string {
+	bundles := readCABundles()
+	if len(bundles) == 0 {
+		return ""
+	}
+
+	combined := []byte{}
+	for _, systemBundle := range append([]string{os.Getenv("SSL_CERT_FILE")}, systemCABundles...) {
+		if systemBundle == "" {
+			continue
+		}
+		if data, err := os.ReadFile(systemBundle); err == nil {
+			combined = append(combined, data...)
+			break
+		}
+	}
+	for _, bundle := range bundles {
+		combined = append(combined, '\n')
+		combined = append(combined, bundle...)
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		log.Fatal("Failed to find the cache directory for the CA bundle of git: %s.\n", err)
+	}
+	bundlePath := path.Join(cacheDir, "dbt", fmt.Sprintf("ca-bundle-%x.pem", sha256.Sum256(combined)))
+	if !util.FileExists(bundlePath) {
+		util.MkdirAll(path.Dir(bundlePath))
+		util.WriteFile(bundlePath, combined)
+	}
+	return bundlePath
+}
+
+// gitEnvironment returns the environment of git and jj subprocesses, which applies the proxies and CA bundles
+// of the user configuration. Returns nil if nothing is configured, so that the subprocesses inherit the
+// environment of dbt.
+//
+// The settings are only passed in the environment, since the command line of a process is visible to all
+// users and proxy URLs might contain credentials. The proxies are passed in the http_proxy and https_proxy
+// variables, which curl reads for each scheme, and the CA bundle in GIT_SSL_CAINFO, which takes precedence
+// over http.sslCAInfo. Both work with all versions of git.
+func gitEnvironment() []string {
+	gitEnvOnce.Do(func() {
+		httpConfig := config.GetConfig().HTTP
+		env := []string{}
+		// curl only reads the lower case variable for http, to keep CGI scripts from setting it.
+		if httpConfig.HTTPProxy != "" {
+			env = append(env, "http_proxy="+httpConfig.HTTPProxy)
+		}
+		if httpConfig.HTTPSProxy != "" {
+			env = append(env, "https_proxy="+httpConfig.HTTPSProxy, "HTTPS_PROXY="+httpConfig.HTTPSProxy)
+		}
+		if httpConfig.NoProxy != "" {
+			env = append(env, "no_proxy="+httpConfig.NoProxy, "NO_PROXY="+httpConfig.NoProxy)
+		}
+		if bundlePath := combinedCABundle(); bundlePath != "" {
+			env = append(env, "GIT_SSL_CAINFO="+bundlePath)
+		}
+		if len(env) > 0 {
+			// Later entries take precedence over the inherited ones.
+			gitEnv = append(os.Environ(), env...)
+		}
+	})
+	return gitEnv
+}
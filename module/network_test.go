@@ -0,0 +1,54 @@
+package module
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProxyForRequest(t *testing.T) {
+	settings := proxySettings{
+		httpProxy:  "http://proxy.example.com:3128",
+		httpsProxy: "proxy.example.com:3129",
+		noProxy:    "internal.example.com, .corp.example.com,10.0.0.0/8,192.168.1.1,artifacts.example.com:8443",
+	}
+
+	cases := []struct {
+		url   string
+		proxy string
+	}{
+		{"http://example.org/a.tar.gz", "http://proxy.example.com:3128"},
+		{"https://example.org/a.tar.gz", "http://proxy.example.com:3129"},
+		{"https://internal.example.com/a.tar.gz", ""},
+		{"https://sub.internal.example.com/a.tar.gz", ""},
+		{"https://notinternal.example.com/a.tar.gz", "http://proxy.example.com:3129"},
+		{"https://git.corp.example.com/a.tar.gz", ""},
+		{"https://corp.example.com/a.tar.gz", ""},
+		{"https://10.1.2.3/a.tar.gz", ""},
+		{"https://11.1.2.3/a.tar.gz", "http://proxy.example.com:3129"},
+		{"http://192.168.1.1/a.tar.gz", ""},
+		{"https://artifacts.example.com:8443/a.tar.gz", ""},
+		{"https://artifacts.example.com/a.tar.gz", "http://proxy.example.com:3129"},
+		{"http://localhost:8080/a.tar.gz", ""},
+		{"http://127.0.0.1:8080/a.tar.gz", ""},
+	}
+	for _, c := range cases {
+		request, err := http.NewRequest("GET", c.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxy, err := settings.proxyForRequest(request)
+		if err != nil {
+			t.Errorf("proxyForRequest(%q) failed: %s", c.url, err)
+			continue
+		}
+		if (proxy == nil && c.proxy != "") || (proxy != nil && proxy.String() != c.proxy) {
+			t.Errorf("proxyForRequest(%q) = %v; expected %q", c.url, proxy, c.proxy)
+		}
+	}
+
+	settings.noProxy = "*"
+	request, _ := http.NewRequest("GET", "https://example.org/a.tar.gz", nil)
+	if proxy, _ := settings.proxyForRequest(request); proxy != nil {
+		t.Errorf("proxyForRequest used proxy %v although no-proxy is '*'", proxy)
+	}
+}
@@ -0,0 +1,63 @@
+package module
+
+import (
+	"path"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+type localFile struct {
+	Replace map[string]string
+}
+
+// ReadReplacements returns the local directories that replace dependencies of the workspace,
+// indexed by dependency name. Replacements in the MODULE.local file of the workspace take
+// precedence over the ones in the user configuration. Relative paths in the MODULE.local file are
+// relative to the workspace root, the ones in the user configuration to its directory.
+func ReadReplacements(workspaceRoot string) map[string]string {
+	replacements := map[string]string{}
+	for name, dir := range config.GetConfig().Replace {
+		replacements[name] = dir
+	}
+
+	localFilePath := path.Join(workspaceRoot, util.LocalFileName)
+	if util.FileExists(localFilePath) {
+		var local localFile
+		util.ReadYaml(localFilePath, &local)
+		for name, dir := range local.Replace {
+			replacements[name] = dir
+		}
+	}
+
+	for name, dir := range replacements {
+		if !path.IsAbs(dir) {
+			dir = path.Join(workspaceRoot, dir)
+		}
+		if !util.DirExists(dir) {
+			log.Fatal("Directory '%s' replacing dependency '%s' does not exist.\n", dir, name)
+		}
+		replacements[name] = path.Clean(dir)
+	}
+	return replacements
+}
+
+// CheckLocalFileIgnored warns if the MODULE.local file of the workspace is tracked by git or not
+// ignored, since its replacements only exist on the local machine.
+func CheckLocalFileIgnored(workspaceRoot string) {
+	if !util.FileExists(path.Join(workspaceRoot, util.LocalFileName)) {
+		return
+	}
+	workspace := GitModule{path: workspaceRoot}
+	if _, _, err := workspace.tryRunGitCommand("rev-parse", "--is-inside-work-tree"); err != nil {
+		return
+	}
+	if _, _, err := workspace.tryRunGitCommand("ls-files", "--error-unmatch", util.LocalFileName); err == nil {
+		log.Warning("%s is tracked by git. Remove it from the repository with 'git rm --cached %s' and add it to .gitignore.\n", util.LocalFileName, util.LocalFileName)
+		return
+	}
+	if _, _, err := workspace.tryRunGitCommand("check-ignore", "-q", util.LocalFileName); err != nil {
+		log.Warning("%s is not ignored by git. Add it to .gitignore so that it is not committed by accident.\n", util.LocalFileName)
+	}
+}
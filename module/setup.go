@@ -0,0 +1,258 @@
+package module
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/config"
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+const defaultSetupTimeout = 10 * time.Second
+
+// SETUP.go scripts only see these environment variables, and the ones listed in the setup policy.
+var defaultSetupEnvironment = []string{
+	"PATH", "HOME", "USER", "TMPDIR", "LANG", "TERM",
+	"GOPATH", "GOROOT", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOFLAGS", "GOPRIVATE", "GONOSUMDB", "GOTOOLCHAIN",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+}
+
+// setupRecord is written to the .setup sentinel file of a module after each run of its SETUP.go script.
+type setupRecord struct {
+	// ScriptHash is the SHA256 hash of the SETUP.go script that ran.
+	ScriptHash string `yaml:"script-hash"`
+	Time       string
+	Duration   string
+	Succeeded  bool
+}
+
+// SetupPolicy combines the setup policies of the user configuration and the top-level MODULE file.
+// Both of them can restrict which modules run setup. Timeouts for individual modules take precedence over
+// generic timeouts, and the user configuration takes precedence over the MODULE file.
+type SetupPolicy struct {
+	policies []config.SetupPolicy
+}
+
+// ReadSetupPolicy reads the setup policy of the workspace.
+func ReadSetupPolicy(workspaceRoot string) SetupPolicy {
+	policy := SetupPolicy{[]config.SetupPolicy{config.GetConfig().Setup}}
+	if moduleFile := ReadModuleFile(workspaceRoot); moduleFile.Setup != nil {
+		policy.policies = append(policy.policies, *moduleFile.Setup)
+	}
+	return policy
+}
+
+// IsAllowed reports whether module `name` may run its SETUP.go script.
+func (p SetupPolicy) IsAllowed(name string) bool {
+	for _, policy := range p.policies {
+		if len(policy.Allow) == 0 {
+			continue
+		}
+		allowed := false
+		for _, allowedName := range policy.Allow {
+			allowed = allowed || allowedName == name
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Timeout returns the time limit of the SETUP.go script of module `name`. A timeout for the module
+// in any policy takes precedence over the generic timeouts.
+func (p SetupPolicy) Timeout(name string) time.Duration {
+	timeouts := []string{}
+	for _, policy := range p.policies {
+		timeouts = append(timeouts, policy.Timeouts[name])
+	}
+	for _, policy := range p.policies {
+		timeouts = append(timeouts, policy.Timeout)
+	}
+
+	for _, timeout := range timeouts {
+		if timeout == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(timeout)
+		if err != nil || duration <= 0 {
+			log.Fatal("Invalid setup timeout '%s' for module '%s'. Use a positive duration like '30s'.\n", timeout, name)
+		}
+		return duration
+	}
+	return defaultSetupTimeout
+}
+
+func (p SetupPolicy) environment(name, modulePath string) []string {
+	names := append([]string{}, defaultSetupEnvironment...)
+	for _, policy := range p.policies {
+		names = append(names, policy.Env...)
+	}
+
+	env := []string{}
+	added := map[string]bool{}
+	for _, variable := range names {
+		if value, ok := os.LookupEnv(variable); ok && !added[variable] {
+			env = append(env, variable+"="+value)
+			added[variable] = true
+		}
+	}
+	return append(env, "DBT_MODULE_NAME="+name, "DBT_MODULE_PATH="+modulePath)
+}
+
+func setupScriptHash(script []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(script))
+}
+
+// SetupPending reports whether the module has a SETUP.go file in revision `rev` that has not
+// successfully run yet.
+func SetupPending(mod Module, rev string) bool {
+	script, exists := mod.ReadFile(rev, setupFileName)
+	if !exists {
+		return false
+	}
+	record, ok := readSetupRecord(mod.RootPath())
+	return !ok || !record.Succeeded || record.ScriptHash != setupScriptHash(script)
+}
+
+func readSetupRecord(modulePath string) (setupRecord, bool) {
+	record := setupRecord{}
+	sentinelPath := path.Join(modulePath, setupSentinelFileName)
+	if !util.FileExists(sentinelPath) {
+		return record, false
+	}
+	util.ReadYaml(sentinelPath, &record)
+	return record, true
+}
+
+// HasSetupScript reports whether the module at `modulePath` has a SETUP.go file.
+func HasSetupScript(modulePath string) bool {
+	return util.FileExists(path.Join(modulePath, setupFileName))
+}
+
+// SetupModule runs the SETUP.go file in the root directory of the module at `modulePath` (if it exists)
+// according to the setup policy. The script does not run again unless it changed since its last successful
+// run, or `force` is set.
+func SetupModule(modulePath string, policy SetupPolicy, force bool) {
+	setupFilePath := path.Join(modulePath, setupFileName)
+	if !HasSetupScript(modulePath) {
+		log.Debug("Module has no %s file. Nothing to do.\n", setupFileName)
+		return
+	}
+
+	name := path.Base(modulePath)
+	if !policy.IsAllowed(name) {
+		log.Warning("Not running %s, since '%s' is not allowed to run setup.\n", setupFileName, name)
+		return
+	}
+
+	scriptHash := setupScriptHash(util.ReadFile(setupFilePath))
+	if record, ok := readSetupRecord(modulePath); ok && !force && record.Succeeded && record.ScriptHash == scriptHash {
+		log.Log("Module is already set up.\n")
+		return
+	}
+
+	timeout := policy.Timeout(name)
+	log.Debug("Running 'go run %s' with a timeout of %s.\n", setupFilePath, timeout)
+	cmd := exec.Command("go", "run", setupFilePath)
+	cmd.Dir = modulePath
+	cmd.Env = policy.environment(name, modulePath)
+	cmd.Stderr = os.Stderr
+	cmd.Stdout = os.Stdout
+
+	start := time.Now()
+	timedOut, err := runWithTimeout(cmd, timeout)
+
+	writeSetupRecord(modulePath, setupRecord{
+		ScriptHash: scriptHash,
+		Time:       start.Format(time.RFC3339),
+		Duration:   time.Since(start).Round(time.Millisecond).String(),
+		Succeeded:  err == nil && !timedOut,
+	})
+	if timedOut {
+		log.Fatal("Running %s timed out after %s. Run 'dbt setup %s' to retry.\n", setupFileName, timeout, name)
+	}
+	if err != nil {
+		log.Fatal("Running %s failed: %s. Run 'dbt setup %s' to retry.\n", setupFileName, err, name)
+	}
+	log.Success("Module is set up.\n")
+}
+
+// runWithTimeout runs `cmd` in its own process group, so that programs started by `go run` are
+// killed together with it once `timeout` expires or dbt is interrupted. It reports whether the
+// command timed out.
+func runWithTimeout(cmd *exec.Cmd, timeout time.Duration) (bool, error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return false, err
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	done := make(chan struct{})
+	timedOut := make(chan bool, 1)
+	go func() {
+		select {
+		case <-time.After(timeout):
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			timedOut <- true
+		case <-interrupts:
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			timedOut <- false
+		case <-done:
+			timedOut <- false
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	return <-timedOut, err
+}
+
+func writeSetupRecord(modulePath string, record setupRecord) {
+	util.WriteYaml(path.Join(modulePath, setupSentinelFileName), record)
+	ignoreSetupSentinel(modulePath)
+}
+
+// ignoreSetupSentinel adds the .setup sentinel file to the excluded files of the git repository of the module,
+// so that it does not make the module dirty.
+func ignoreSetupSentinel(modulePath string) {
+	mod, isGit := OpenModule(modulePath).(GitModule)
+	if !isGit {
+		return
+	}
+	excludeFilePath, _, err := mod.tryRunGitCommand("rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return
+	}
+	if !filepath.IsAbs(excludeFilePath) && mod.repoPath != "" {
+		excludeFilePath = path.Join(mod.repoPath, excludeFilePath)
+	} else if !filepath.IsAbs(excludeFilePath) {
+		excludeFilePath = path.Join(mod.path, excludeFilePath)
+	}
+
+	content := ""
+	if util.FileExists(excludeFilePath) {
+		content = string(util.ReadFile(excludeFilePath))
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == setupSentinelFileName {
+			return
+		}
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	util.WriteFile(excludeFilePath, []byte(content+setupSentinelFileName+"\n"))
+}
@@ -0,0 +1,35 @@
+package module
+
+import (
+	"testing"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/config"
+)
+
+func TestSetupPolicyTimeout(t *testing.T) {
+	userPolicy := config.SetupPolicy{Timeout: "1m", Timeouts: map[string]string{"user": "2m"}}
+	modulePolicy := config.SetupPolicy{Timeout: "3m", Timeouts: map[string]string{"user": "4m", "module": "5m"}}
+	policy := SetupPolicy{[]config.SetupPolicy{userPolicy, modulePolicy}}
+
+	cases := []struct {
+		name     string
+		expected time.Duration
+	}{
+		{"user", 2 * time.Minute},
+		{"module", 5 * time.Minute},
+		{"other", time.Minute},
+	}
+	for _, c := range cases {
+		if timeout := policy.Timeout(c.name); timeout != c.expected {
+			t.Errorf("Timeout(%q) = %s; expected %s", c.name, timeout, c.expected)
+		}
+	}
+
+	if timeout := (SetupPolicy{[]config.SetupPolicy{{}, {Timeout: "3m"}}}).Timeout("module"); timeout != 3*time.Minute {
+		t.Errorf("Timeout(%q) = %s; expected the timeout of the MODULE file", "module", timeout)
+	}
+	if timeout := (SetupPolicy{[]config.SetupPolicy{{}}}).Timeout("module"); timeout != defaultSetupTimeout {
+		t.Errorf("Timeout(%q) = %s; expected the default timeout", "module", timeout)
+	}
+}
@@ -0,0 +1,104 @@
+package module
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// Dependencies that are a subdirectory of a repository or archive are cloned into
+// DEPS/.repos/<name>/, and DEPS/<name> is a symlink to the subdirectory.
+
+func subdirRepositoryPath(modulePath string) string {
+	return path.Join(path.Dir(modulePath), util.SubdirReposDirName, path.Base(modulePath))
+}
+
+func subdirLinkTarget(modulePath, subdir string) string {
+	return path.Join(util.SubdirReposDirName, path.Base(modulePath), subdir)
+}
+
+// IsSubdirLink reports whether `modulePath` is a symlink to the subdirectory of a repository in DEPS/.repos/.
+func IsSubdirLink(modulePath string) bool {
+	target, err := os.Readlink(modulePath)
+	return err == nil && strings.HasPrefix(target, util.SubdirReposDirName+"/")
+}
+
+// SubdirLinkMatches reports whether `modulePath` links to `subdir` of its repository, or is no subdirectory link
+// at all if `subdir` is empty.
+func SubdirLinkMatches(modulePath, subdir string) bool {
+	if subdir == "" {
+		return !IsSubdirLink(modulePath)
+	}
+	target, err := os.Readlink(modulePath)
+	return err == nil && target == subdirLinkTarget(modulePath, subdir)
+}
+
+// openOrCloneSubdirModule opens or clones the repository of a module that is a subdirectory of the
+// repository and links the subdirectory to `modulePath`.
+func openOrCloneSubdirModule(modulePath, url, moduleTypeString string, options CloneOptions) (Module, bool) {
+	if DetermineModuleType(url, moduleTypeString) == JujutsuModuleType {
+		options.Logger.Fatal("Subdirectories are not supported for jj modules.\n")
+	}
+	if cleanSubdir := path.Clean(options.Subdir); path.IsAbs(cleanSubdir) || cleanSubdir == ".." || strings.HasPrefix(cleanSubdir, "../") {
+		options.Logger.Fatal("Subdirectory '%s' must be a relative path inside of the repository.\n", options.Subdir)
+	}
+
+	info, err := os.Lstat(modulePath)
+	if err == nil && (info.Mode()&os.ModeSymlink) != os.ModeSymlink {
+		options.Logger.Fatal("'%s' is a checked out module. Remove it to use the subdirectory '%s' of the repository.\n", modulePath, options.Subdir)
+	}
+
+	repoPath := subdirRepositoryPath(modulePath)
+	repoOptions := options
+	repoOptions.Subdir = ""
+	_, created := OpenOrCloneModule(repoPath, url, moduleTypeString, repoOptions)
+
+	target := subdirLinkTarget(modulePath, options.Subdir)
+	if current, _ := os.Readlink(modulePath); current != target {
+		if err == nil {
+			os.Remove(modulePath)
+		}
+		options.Logger.Debug("Creating symlink '%s' -> '%s'.\n", modulePath, target)
+		if err := os.Symlink(target, modulePath); err != nil {
+			options.Logger.Fatal("Failed to create symlink for subdirectory '%s': %s.\n", options.Subdir, err)
+		}
+	}
+
+	return withLogger(OpenModule(modulePath), options.Logger), created
+}
+
+// openSubdirModule opens a module whose directory is a symlink to a subdirectory of a repository or archive.
+// The subdirectory does not need to exist in the current revision of the repository.
+func openSubdirModule(modulePath string) (Module, bool) {
+	target, err := os.Readlink(modulePath)
+	if err != nil {
+		return nil, false
+	}
+	if !filepath.IsAbs(target) {
+		target = path.Join(path.Dir(modulePath), target)
+	}
+
+	for repoPath := path.Dir(target); repoPath != "/" && repoPath != "."; repoPath = path.Dir(repoPath) {
+		subdir := strings.TrimPrefix(target, repoPath+"/")
+		if util.DirExists(path.Join(repoPath, ".git")) || util.FileExists(path.Join(repoPath, ".git")) {
+			log.Debug("Found repository '%s' for subdirectory '%s'.\n", repoPath, subdir)
+			repo := OpenModule(repoPath).(GitModule)
+			repo.path = modulePath
+			repo.repoPath = repoPath
+			repo.subdir = subdir
+			return repo, true
+		}
+		if util.FileExists(path.Join(repoPath, tarMetadataFileName)) {
+			log.Debug("Found archive '%s' for subdirectory '%s'.\n", repoPath, subdir)
+			repo := OpenModule(repoPath).(TarModule)
+			repo.path = modulePath
+			repo.repoPath = repoPath
+			return repo, true
+		}
+	}
+	return nil, false
+}
@@ -1,20 +1,17 @@
 package module
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/daedaleanai/dbt/v3/config"
 	"github.com/daedaleanai/dbt/v3/log"
-	"github.com/daedaleanai/dbt/v3/netrc"
 	"github.com/daedaleanai/dbt/v3/util"
 )
 
@@ -27,17 +24,26 @@ type metadataFile struct {
 	Sha256 string
 }
 
-// TarModule is a module backed by a tar.gz archive.
+// TarModule is a module backed by an archive: a tar archive (optionally compressed with gzip, xz,
+// zstd or bzip2), or a zip archive.
 // TarModules only have a single "master" version.
 type TarModule struct {
 	path   string
 	mirror *TarMirror
+	// repoPath is the directory the archive was extracted to if the module is a subdirectory of the archive.
+	repoPath string
+	// logger prints the messages of cloning the module, see CloneOptions.Logger.
+	logger *log.Logger
 }
 
 type TarMirror struct {
 	path string
 }
 
+// currentMirrors holds the paths of the mirrors that have been downloaded or updated by this invocation
+// of dbt. Their content is current, so it is not downloaded again.
+var currentMirrors sync.Map
+
 func getRoot(p string) string {
 	firstSlash := strings.IndexByte(p, '/')
 	if firstSlash == -1 {
@@ -55,17 +61,33 @@ func stripRoot(p string) string {
 	return p[len(root):]
 }
 
-// Obtains a mirror for a tar module if the global mirror directory has been set up
-func getOrCreateTarMirror(url string) (*TarMirror, error) {
+// Returns the path of the mirror for a tar module, or an empty string if the global mirror
+// directory has not been set up.
+func tarMirrorPath(url string) string {
 	configuration := config.GetConfig()
 	if configuration.Mirror == "" {
-		log.Debug("Mirrors are not configured.\n")
-		return nil, nil
+		return ""
 	}
 
 	urlHash := sha256.Sum256([]byte(url))
 	urlHashString := fmt.Sprintf("tar-%x", urlHash[:])
-	mirrorPath := path.Join(configuration.Mirror, urlHashString)
+	return path.Join(configuration.Mirror, urlHashString)
+}
+
+// Obtains a mirror for a tar module if the global mirror directory has been set up
+func getOrCreateTarMirror(url string) (*TarMirror, error) {
+	mirrorPath := tarMirrorPath(url)
+	if mirrorPath == "" {
+		log.Debug("Mirrors are not configured.\n")
+		return nil, nil
+	}
+	return openOrCreateTarMirror(url, mirrorPath)
+}
+
+// openOrCreateTarMirror opens the mirror of `url` at `mirrorPath`, or downloads it if it does not exist yet.
+func openOrCreateTarMirror(url, mirrorPath string) (*TarMirror, error) {
+	// Several modules might use the same mirror when they are cloned in parallel.
+	defer lockMirror(mirrorPath)()
 
 	log.Debug("Looking for mirror of '%s' in directory '%s'.\n", url, mirrorPath)
 
@@ -74,15 +96,22 @@ func getOrCreateTarMirror(url string) (*TarMirror, error) {
 		return &TarMirror{path: mirrorPath}, nil
 	}
 
+	if Offline || ReadOnly {
+		log.Debug("No mirror found. Not downloading a mirror in offline or read-only mode.\n")
+		return nil, nil
+	}
+
 	util.MkdirAll(mirrorPath)
-	mod := TarModule{mirrorPath, nil}
-	if err := mod.download(url); err != nil {
+	// The mirror caches the archive as it is, it is checked against the pinned hash when it is copied.
+	mod := TarModule{path: mirrorPath}
+	if err := mod.download(url, ""); err != nil {
 		// If downloading fails, we remove the mirror path to leave a clean tree so that the
 		// operation can be retried.
 		util.RemoveDir(mod.path)
 		return nil, err
 	}
 	log.Debug("Mirror downloaded at '%s'.\n", mirrorPath)
+	currentMirrors.Store(mirrorPath, true)
 
 	return &TarMirror{path: mirrorPath}, nil
 }
@@ -90,14 +119,15 @@ func getOrCreateTarMirror(url string) (*TarMirror, error) {
 // createTarModule creates a new TarModule in the given `modulePath` by downloading
 // and extracting the TAR archive reference by `url`. The origin of the module
 // (i.e., the download url) is stored in a ".metadata" file inside the module directory.
-func createTarModule(modulePath, url string) (Module, error) {
+// Unless `expectedHash` is empty, the archive is only extracted if its hash matches.
+func createTarModule(modulePath, url, expectedHash string, logger *log.Logger) (Module, error) {
 	mirror, err := getOrCreateTarMirror(url)
 	if err != nil {
 		return nil, err
 	}
 
-	module := TarModule{path: modulePath, mirror: mirror}
-	err = module.clone(url)
+	module := TarModule{path: modulePath, mirror: mirror, logger: logger}
+	err = module.clone(url, expectedHash)
 	if err != nil {
 		return nil, err
 	}
@@ -113,17 +143,25 @@ func (m TarModule) RootPath() string {
 	return m.path
 }
 
+// metadataFilePath returns the path of the metadata file, which is stored next to the extracted archive.
+func (m TarModule) metadataFilePath() string {
+	if m.repoPath != "" {
+		return path.Join(m.repoPath, tarMetadataFileName)
+	}
+	return path.Join(m.path, tarMetadataFileName)
+}
+
 // URL returns the url of the underlying tar archive.
 func (m TarModule) URL() string {
 	var metadata metadataFile
-	util.ReadYaml(path.Join(m.path, tarMetadataFileName), &metadata)
+	util.ReadYaml(m.metadataFilePath(), &metadata)
 	return metadata.URL
 }
 
 // Head returns the default version for all TarModules.
 func (m TarModule) Head() string {
 	var metadata metadataFile
-	util.ReadYaml(path.Join(m.path, tarMetadataFileName), &metadata)
+	util.ReadYaml(m.metadataFilePath(), &metadata)
 	return metadata.Sha256
 }
 
@@ -142,6 +180,26 @@ func (m TarModule) IsAncestor(ancestor, rev string) bool {
 	return true
 }
 
+// Tags returns no tags, since TarModules are not versioned.
+func (m TarModule) Tags() map[string]string {
+	return map[string]string{}
+}
+
+// HasCommit reports whether `hash` is the version of the module, since TarModules only have a single version.
+func (m TarModule) HasCommit(hash string) bool {
+	return hash == m.Head()
+}
+
+// ReadFile returns the content of the file at `filePath` (relative to the module root) and whether
+// it exists. TarModules only have a single version, so `rev` is ignored.
+func (m TarModule) ReadFile(rev, filePath string) ([]byte, bool) {
+	data, err := os.ReadFile(path.Join(m.path, filePath))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
 // Fetch does nothing on TarModules and reports that no changes have been fetched.
 func (m TarModule) Fetch() bool {
 	return false
@@ -162,132 +220,160 @@ func (m TarModule) Type() ModuleType {
 
 // clones a tar from either a mirror (if the tar module contains one and is valid) or downloaded from
 // the network
-func (m TarModule) clone(url string) error {
+func (m TarModule) clone(url, expectedHash string) error {
 	// Check if it is available already in the mirror
 	if m.mirror != nil {
-		// Validate the mirror by making sure the metadata path is present
-		metdata_path := path.Join(m.mirror.path, tarMetadataFileName)
-		if util.FileExists(metdata_path) {
-			err := util.CopyDirRecursively(m.mirror.path, m.path)
+		if copied, err := m.cloneFromMirror(url, expectedHash); copied || err != nil {
 			return err
 		}
 	}
 
+	if Offline {
+		return fmt.Errorf("'%s' is not available in the local mirror", url)
+	}
+
 	// Mirror not available download instead
-	return m.download(url)
+	if err := m.download(url, expectedHash); err != nil {
+		return err
+	}
+	if m.mirror != nil {
+		// The download matches the pinned hash or is the latest version of the archive, so later clones
+		// can use it instead of the stale mirror.
+		if err := m.mirror.update(m.path); err != nil {
+			m.logger.Warning("Failed to update the mirror of '%s': %s.\n", url, err)
+		}
+	}
+	return nil
+}
+
+// cloneFromMirror copies the archive from the mirror if it matches `expectedHash`, and reports whether
+// it did so. Without an `expectedHash`, the mirror is only copied if it is current or dbt is offline,
+// so that updating a module picks up the latest version of the archive.
+func (m TarModule) cloneFromMirror(url, expectedHash string) (bool, error) {
+	defer lockMirror(m.mirror.path)()
+
+	// Validate the mirror by making sure the metadata path is present
+	if !util.FileExists(path.Join(m.mirror.path, tarMetadataFileName)) {
+		return false, nil
+	}
+	mirrorHash := TarModule{path: m.mirror.path}.Head()
+	_, isCurrent := currentMirrors.Load(m.mirror.path)
+	if mirrorHash == expectedHash || expectedHash == "" && (isCurrent || Offline) {
+		return true, util.CopyDirRecursively(m.mirror.path, m.path)
+	}
+	if isCurrent || Offline {
+		// Downloading the archive again would not change its hash.
+		return false, checkArchiveHash(url, mirrorHash, expectedHash)
+	}
+	if expectedHash == "" {
+		m.logger.Debug("The mirror might be stale. Downloading the latest version of the archive.\n")
+	} else {
+		m.logger.Debug("The mirror has hash '%s' instead of '%s'. Downloading the archive instead.\n", mirrorHash, expectedHash)
+	}
+	return false, nil
 }
 
-// Downloads a tar.gz gziped archive from the provided url
-func (m TarModule) download(url string) error {
-	log.Log("Downloading '%s'.\n", url)
+// update replaces the content of the mirror with the archive extracted to `modulePath`.
+func (m *TarMirror) update(modulePath string) error {
+	defer lockMirror(m.path)()
 
-	request, err := http.NewRequest("GET", url, nil)
+	log.Debug("Updating mirror '%s' from '%s'.\n", m.path, modulePath)
+	newPath, err := os.MkdirTemp(path.Dir(m.path), path.Base(m.path)+".new-*")
 	if err != nil {
-		return fmt.Errorf("failed to construct HTTP request to download archive: %s", err)
+		return err
+	}
+	if err := copyTree(modulePath, newPath); err != nil {
+		os.RemoveAll(newPath)
+		return err
+	}
+	// MkdirTemp creates the directory only accessible to the user.
+	if err := os.Chmod(newPath, 0775); err != nil {
+		os.RemoveAll(newPath)
+		return err
 	}
+	if err := os.RemoveAll(m.path); err != nil {
+		os.RemoveAll(newPath)
+		return err
+	}
+	if err := os.Rename(newPath, m.path); err != nil {
+		return err
+	}
+	currentMirrors.Store(m.path, true)
+	return nil
+}
 
-	if auth := netrc.GetAuthForUrl(url); auth != nil {
-		log.Debug("Using netrc auth for url %q\n", url)
-		request.SetBasicAuth(auth.User, auth.Password)
+// checkArchiveHash fails if the hash of the archive at `url` is not the pinned hash.
+func checkArchiveHash(url, hash, expectedHash string) error {
+	if expectedHash == "" || hash == expectedHash {
+		return nil
 	}
+	return fmt.Errorf("the archive at '%s' has hash '%s', but it is pinned to hash '%s'. "+
+		"Its content has changed since it was pinned, which might be a sign of a supply-chain attack. "+
+		"Review the new content and run 'dbt sync --update' to accept it", url, hash, expectedHash)
+}
 
-	response, err := http.DefaultClient.Do(request)
+// downloadArchive downloads the archive at `url` into a temporary file and returns it with its hash.
+// The caller has to close and remove the file.
+func downloadArchive(url string, logger *log.Logger) (*os.File, string, error) {
+	archive, err := os.CreateTemp("", "dbt-archive-*")
 	if err != nil {
-		return fmt.Errorf("failed to download archive: %s", err)
+		return nil, "", fmt.Errorf("failed to create temporary file: %s", err)
+	}
+	removeArchive := func() {
+		archive.Close()
+		os.Remove(archive.Name())
 	}
-	defer response.Body.Close()
 
+	settings := readHTTPSettings()
+	settings.logger = logger
+	if err := downloadFile(url, archive, settings); err != nil {
+		removeArchive()
+		return nil, "", err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		removeArchive()
+		return nil, "", fmt.Errorf("failed to read archive: %s", err)
+	}
 	hasher := sha256.New()
-	gzFile := io.TeeReader(response.Body, hasher)
+	if _, err := io.Copy(hasher, archive); err != nil {
+		removeArchive()
+		return nil, "", fmt.Errorf("failed to read archive: %s", err)
+	}
+	return archive, hex.EncodeToString(hasher.Sum(nil)), nil
+}
 
-	tarFile, err := gzip.NewReader(gzFile)
+// RemoteHash downloads the archive from the module's URL and returns its hash without extracting it.
+func (m TarModule) RemoteHash() (string, error) {
+	archive, hash, err := downloadArchive(m.URL(), m.logger)
 	if err != nil {
-		return fmt.Errorf("failed to decompress: %s", err)
+		return "", err
 	}
+	archive.Close()
+	os.Remove(archive.Name())
+	return hash, nil
+}
 
-	tarReader := tar.NewReader(tarFile)
-	tarRootDir := ""
-	for {
-		header, err := tarReader.Next()
-
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to decompress: %s", err)
-		}
+// Downloads an archive from the provided url and extracts it. The archive is only extracted if its hash
+// matches `expectedHash`, unless it is empty.
+func (m TarModule) download(url, expectedHash string) error {
+	m.logger.Log("Downloading '%s'.\n", url)
 
-		headerRootDir := getRoot(header.Name)
-		if header.Typeflag != tar.TypeDir && headerRootDir == header.Name {
-			return fmt.Errorf("failed to decompress: archive can't have files outside root directory")
-		}
-		if tarRootDir == "" {
-			tarRootDir = headerRootDir
-		} else if tarRootDir != headerRootDir {
-			return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
-		}
+	// The archive is downloaded completely before extracting it, so that its hash can be checked.
+	archive, hash, err := downloadArchive(url, m.logger)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
 
-		// We can't assume that tarReader visits a dir before the files inside it, although this is true most of the time.
-		// So if we find a file whose dir hasn't been created yet, we make it, with a sensible default access mode
-		// When we eventually visit it, we set the correct mode
-		switch header.Typeflag {
-		case tar.TypeDir:
-			dirPath := path.Join(m.path, stripRoot(header.Name))
-			log.Debug("Creating directory '%s'.\n", dirPath)
-			if err := os.MkdirAll(dirPath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to create directory: %s", err)
-			}
-			// We need this again because if the dir already existed os.MkdirAll does nothing
-			if err := os.Chmod(dirPath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to change filemode: %s", err)
-			}
-		case tar.TypeReg:
-			filePath := path.Join(m.path, stripRoot(header.Name))
-			if err := os.MkdirAll(path.Dir(filePath), defaultDirMode); err != nil {
-				return fmt.Errorf("failed to create directory: %s", err)
-			}
-			log.Debug("Creating file '%s'.\n", filePath)
-			file, err := os.Create(filePath)
-			if err != nil {
-				return fmt.Errorf("failed to create file: %s", err)
-			}
-			_, err = io.Copy(file, tarReader)
-			file.Close()
-			if err != nil {
-				return fmt.Errorf("failed to write file: %s", err)
-			}
-			if err := os.Chmod(filePath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to change filemode: %s", err)
-			}
-		case tar.TypeLink:
-			if getRoot(header.Linkname) != tarRootDir {
-				return fmt.Errorf("failed to decompress: archive can't have more than one root directory")
-			}
-			oldname := path.Join(m.path, stripRoot(header.Linkname))
-			newname := path.Join(m.path, stripRoot(header.Name))
-			if err := os.MkdirAll(path.Dir(newname), defaultDirMode); err != nil {
-				return fmt.Errorf("failed to create directory: %s", err)
-			}
-			log.Debug("Creating link from '%s' to '%s'.\n", newname, oldname)
-			if err = os.Link(oldname, newname); err != nil {
-				return fmt.Errorf("failed to create link: %s", err)
-			}
-		case tar.TypeSymlink:
-			newname := path.Join(m.path, stripRoot(header.Name))
-			if err := os.MkdirAll(path.Dir(newname), defaultDirMode); err != nil {
-				return fmt.Errorf("failed to create directory: %s", err)
-			}
-			log.Debug("Creating symlink from '%s' to '%s'.\n", newname, header.Linkname)
-			if err := os.Symlink(header.Linkname, newname); err != nil {
-				return fmt.Errorf("failed to create symlink: %s", err)
-			}
-
-		default:
-			return fmt.Errorf("unknown tar type flag %d for entry '%s'", header.Typeflag, header.Name)
-		}
+	if err := checkArchiveHash(url, hash, expectedHash); err != nil {
+		return err
+	}
+	if err := m.extract(url, archive); err != nil {
+		return err
 	}
 
-	metadata := metadataFile{url, hex.EncodeToString(hasher.Sum(nil))}
+	metadata := metadataFile{url, hash}
 	util.WriteYaml(path.Join(m.path, tarMetadataFileName), metadata)
 	return nil
 }
@@ -0,0 +1,256 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/daedaleanai/dbt/v3/log"
+	"github.com/daedaleanai/dbt/v3/util"
+)
+
+// Modules deleted by 'dbt sync' are moved to DEPS/.trash/<timestamp>/, keeping their path relative
+// to DEPS/, so that they can be restored with 'dbt restore-dep'.
+
+const trashTimestampFormat = "20060102-150405"
+
+// TrashEntry is a module or repository in the trash.
+type TrashEntry struct {
+	// Name is the name of the module.
+	Name string
+	// Path is the location of the module in the trash.
+	Path string
+	// DepsPath is the path of the module relative to the DEPS/ directory.
+	DepsPath string
+	// DeletedAt is the time the module was moved to the trash.
+	DeletedAt time.Time
+}
+
+func trashPath(workspaceRoot string) string {
+	return path.Join(workspaceRoot, util.DepsDirName, util.TrashDirName)
+}
+
+// LocalChanges describes the work in the module at `modulePath` that would be lost by deleting it:
+// uncommitted changes and commits that are not on any remote branch. Only git repositories are checked.
+func LocalChanges(modulePath string) []string {
+	if info, err := os.Lstat(modulePath); err != nil || (info.Mode()&os.ModeSymlink) == os.ModeSymlink {
+		return nil
+	}
+	if !util.DirExists(path.Join(modulePath, ".git")) && !util.FileExists(path.Join(modulePath, ".git")) {
+		return nil
+	}
+
+	mod := GitModule{path: modulePath}
+	changes := []string{}
+	if status, _, err := mod.tryRunGitCommand("status", "-s"); err != nil {
+		changes = append(changes, fmt.Sprintf("the state of the repository is unknown: %s", err))
+	} else if len(status) > 0 {
+		changes = append(changes, "uncommitted changes")
+	}
+	if count, err := mod.UnpushedCommits("HEAD", "--branches"); err != nil {
+		changes = append(changes, fmt.Sprintf("the unpushed commits are unknown: %s", err))
+	} else if count > 0 {
+		changes = append(changes, fmt.Sprintf("%d unpushed commits", count))
+	}
+	return changes
+}
+
+// MoveToTrash moves the modules at `modulePaths` in the DEPS/ directory to a new directory in the trash.
+// Symlinks are removed, since they do not hold any content. Returns the directory in the trash, or
+// an empty string if nothing was moved.
+func MoveToTrash(workspaceRoot string, modulePaths []string) string {
+	depsDir := path.Join(workspaceRoot, util.DepsDirName)
+	batchDir := ""
+	for _, modulePath := range modulePaths {
+		info, err := os.Lstat(modulePath)
+		if err != nil {
+			continue
+		}
+		if (info.Mode() & os.ModeSymlink) == os.ModeSymlink {
+			log.Debug("Removing symlink '%s'.\n", modulePath)
+			if err := os.Remove(modulePath); err != nil {
+				log.Fatal("Failed to remove symlink '%s': %s.\n", modulePath, err)
+			}
+			continue
+		}
+
+		if batchDir == "" {
+			batchDir = createTrashBatchDir(workspaceRoot)
+		}
+		relPath, err := filepath.Rel(depsDir, modulePath)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, "../") {
+			log.Fatal("'%s' is not in the %s/ directory.\n", modulePath, util.DepsDirName)
+		}
+		trashedPath := path.Join(batchDir, relPath)
+		util.MkdirAll(path.Dir(trashedPath))
+		log.Debug("Moving '%s' to '%s'.\n", modulePath, trashedPath)
+		if err := moveDir(modulePath, trashedPath); err != nil {
+			log.Fatal("Failed to move '%s' to the trash: %s.\n", modulePath, err)
+		}
+	}
+	return batchDir
+}
+
+func createTrashBatchDir(workspaceRoot string) string {
+	util.EnsureManagedDir(util.DepsDirName)
+	timestamp := time.Now().Format(trashTimestampFormat)
+	batchDir := path.Join(trashPath(workspaceRoot), timestamp)
+	for idx := 2; util.DirExists(batchDir); idx++ {
+		batchDir = path.Join(trashPath(workspaceRoot), fmt.Sprintf("%s-%d", timestamp, idx))
+	}
+	util.MkdirAll(batchDir)
+	return batchDir
+}
+
+// ReadTrash returns all modules in the trash, most recently deleted first.
+func ReadTrash(workspaceRoot string) []TrashEntry {
+	batches, err := os.ReadDir(trashPath(workspaceRoot))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		log.Fatal("Failed to read the trash: %s.\n", err)
+	}
+
+	entries := []TrashEntry{}
+	for _, batch := range batches {
+		if !batch.IsDir() || len(batch.Name()) < len(trashTimestampFormat) {
+			continue
+		}
+		deletedAt, err := time.ParseInLocation(trashTimestampFormat, batch.Name()[:len(trashTimestampFormat)], time.Local)
+		if err != nil {
+			continue
+		}
+		batchDir := path.Join(trashPath(workspaceRoot), batch.Name())
+		modules, _ := os.ReadDir(batchDir)
+		for _, mod := range modules {
+			if mod.Name() != util.SubdirReposDirName {
+				entries = append(entries, TrashEntry{mod.Name(), path.Join(batchDir, mod.Name()), mod.Name(), deletedAt})
+				continue
+			}
+			repos, _ := os.ReadDir(path.Join(batchDir, util.SubdirReposDirName))
+			for _, repo := range repos {
+				depsPath := path.Join(util.SubdirReposDirName, repo.Name())
+				entries = append(entries, TrashEntry{repo.Name(), path.Join(batchDir, depsPath), depsPath, deletedAt})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].DeletedAt.Equal(entries[j].DeletedAt) {
+			return entries[i].DeletedAt.After(entries[j].DeletedAt)
+		}
+		return entries[i].Path > entries[j].Path
+	})
+	return entries
+}
+
+// RestoreFromTrash moves a module from the trash back to the DEPS/ directory and returns its new path.
+func RestoreFromTrash(workspaceRoot string, entry TrashEntry) string {
+	modulePath := path.Join(workspaceRoot, util.DepsDirName, entry.DepsPath)
+	if _, err := os.Lstat(modulePath); err == nil {
+		log.Fatal("'%s' already exists. Move it out of the way to restore '%s'.\n", modulePath, entry.Name)
+	}
+	util.EnsureManagedDir(util.DepsDirName)
+	util.MkdirAll(path.Dir(modulePath))
+	if err := moveDir(entry.Path, modulePath); err != nil {
+		log.Fatal("Failed to restore '%s': %s.\n", entry.Name, err)
+	}
+
+	removeEmptyTrashDirs(workspaceRoot, entry)
+	return modulePath
+}
+
+// PurgeTrash deletes the modules that have been moved to the trash before `deletedBefore` for good,
+// and returns the number of deleted modules.
+func PurgeTrash(workspaceRoot string, deletedBefore time.Time) int {
+	count := 0
+	for _, entry := range ReadTrash(workspaceRoot) {
+		if !entry.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+		log.Debug("Deleting '%s'.\n", entry.Path)
+		util.RemoveDir(entry.Path)
+		removeEmptyTrashDirs(workspaceRoot, entry)
+		count++
+	}
+	return count
+}
+
+// removeEmptyTrashDirs removes the directories of the trash that became empty by removing `entry`.
+func removeEmptyTrashDirs(workspaceRoot string, entry TrashEntry) {
+	for dir := path.Dir(entry.Path); dir != trashPath(workspaceRoot); dir = path.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+}
+
+// moveDir moves the directory at `source` to `dest`. If they are on different file systems, the
+// directory is copied and only removed once the copy is complete.
+func moveDir(source, dest string) error {
+	err := os.Rename(source, dest)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	log.Debug("'%s' and '%s' are on different file systems. Copying instead.\n", source, dest)
+	if err := copyTree(source, dest); err != nil {
+		os.RemoveAll(dest)
+		return fmt.Errorf("failed to copy '%s' to '%s': %s", source, dest, err)
+	}
+	return os.RemoveAll(source)
+}
+
+// copyTree copies the directory at `source` to `dest`, preserving symlinks and file modes.
+func copyTree(source, dest string) error {
+	return filepath.Walk(source, func(sourcePath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(source, sourcePath)
+		if err != nil {
+			return err
+		}
+		destPath := path.Join(dest, relPath)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(destPath, info.Mode().Perm())
+		case (info.Mode() & os.ModeSymlink) == os.ModeSymlink:
+			target, err := os.Readlink(sourcePath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, destPath)
+		case info.Mode().IsRegular():
+			return copyRegularFile(sourcePath, destPath, info.Mode().Perm())
+		default:
+			return fmt.Errorf("cannot copy '%s': unsupported file type", sourcePath)
+		}
+	})
+}
+
+func copyRegularFile(sourcePath, destPath string, mode fs.FileMode) error {
+	sourceFile, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
+		destFile.Close()
+		return err
+	}
+	return destFile.Close()
+}
@@ -1,12 +1,14 @@
 package netrc
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path"
 	"strings"
-
-	"github.com/daedaleanai/dbt/v3/log"
+	"sync"
 )
 
 type BasicAuth struct {
@@ -14,88 +16,267 @@ type BasicAuth struct {
 	Password string
 }
 
-type netrc struct {
+// Netrc holds the credentials of a netrc file.
+type Netrc struct {
 	machines map[string]BasicAuth
+	// defaultAuth holds the credentials of the 'default' entry, which are used for all other machines.
+	defaultAuth *BasicAuth
 }
 
-var usersNetrcFile netrc = netrc{
-	machines: make(map[string]BasicAuth),
+var usersNetrcFile *Netrc
+var usersNetrcErr error
+var usersNetrcOnce sync.Once
+
+// netrcPath returns the path of the netrc file: $NETRC if it is set, $HOME/.netrc otherwise.
+// It also reports whether the path was set explicitly.
+func netrcPath() (string, bool, error) {
+	if netrcEnvVar := os.Getenv("NETRC"); netrcEnvVar != "" {
+		return netrcEnvVar, true, nil
+	}
+	homeEnvVar := os.Getenv("HOME")
+	if homeEnvVar == "" {
+		return "", false, fmt.Errorf("neither NETRC nor HOME environment variable is set")
+	}
+	return path.Join(homeEnvVar, ".netrc"), false, nil
 }
 
-func init() {
-	parseNetrc()
+// Load reads the netrc file at `netrcPath`. A missing file is only an error if `required` is set.
+func Load(netrcPath string, required bool) (*Netrc, error) {
+	data, err := os.ReadFile(netrcPath)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return &Netrc{machines: map[string]BasicAuth{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc file: %s", err)
+	}
+	netrc, err := Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse netrc file '%s': %s", netrcPath, err)
+	}
+	return netrc, nil
 }
 
-func parseNetrc() {
-	var homeEnvVar string
-	for _, v := range os.Environ() {
-		parts := strings.Split(v, "=")
-		if len(parts) == 2 {
-			key := parts[0]
-			if key == "HOME" {
-				homeEnvVar = parts[1]
-			}
+// tokenizer splits the content of a netrc file into tokens separated by whitespace. Tokens can be
+// quoted with double quotes and contain escaped characters. Comments start with '#' at the start
+// of a line or where a keyword is expected, and end at the end of the line.
+type tokenizer struct {
+	data string
+	pos  int
+	line int
+}
+
+// atLineStart reports whether only whitespace precedes the current position on its line.
+func (t *tokenizer) atLineStart() bool {
+	for i := t.pos - 1; i >= 0 && t.data[i] != '\n'; i-- {
+		if !strings.ContainsRune(" \t\r", rune(t.data[i])) {
+			return false
 		}
 	}
-	if homeEnvVar == "" {
-		log.Warning("Unable to find HOME environment variable. netrc not parsed.\n")
-		return
+	return true
+}
+
+// skipWhitespace skips whitespace and comments. If `keyword` is not set, a '#' only starts a
+// comment at the start of a line, so that values such as passwords may begin with '#'.
+func (t *tokenizer) skipWhitespace(keyword bool) {
+	for t.pos < len(t.data) {
+		switch t.data[t.pos] {
+		case '\n':
+			t.line++
+		case ' ', '\t', '\r':
+		case '#':
+			if !keyword && !t.atLineStart() {
+				return
+			}
+			for t.pos < len(t.data) && t.data[t.pos] != '\n' {
+				t.pos++
+			}
+			continue
+		default:
+			return
+		}
+		t.pos++
 	}
+}
 
-	netrcPath := path.Join(homeEnvVar, ".netrc")
-	netrcContents, err := os.ReadFile(netrcPath)
-	if err != nil {
-		log.Warning("Error reading %q.\n", netrcPath)
-		return
+// next returns the next token, or false at the end of the data. `keyword` tells whether the
+// token is expected to be a keyword rather than a value.
+func (t *tokenizer) next(keyword bool) (string, bool, error) {
+	t.skipWhitespace(keyword)
+	if t.pos >= len(t.data) {
+		return "", false, nil
 	}
 
-	netrcLines := strings.Split(string(netrcContents), "\n")
-	currentMachine := ""
+	if t.data[t.pos] != '"' {
+		start := t.pos
+		for t.pos < len(t.data) && !strings.ContainsRune(" \t\r\n", rune(t.data[t.pos])) {
+			t.pos++
+		}
+		return t.data[start:t.pos], true, nil
+	}
 
-	saveUsername := func(machine, login string) {
-		if machine != "" {
-			if m, ok := usersNetrcFile.machines[machine]; ok {
-				usersNetrcFile.machines[machine] = BasicAuth{User: login, Password: m.Password}
-			} else {
-				usersNetrcFile.machines[machine] = BasicAuth{User: login}
+	token := strings.Builder{}
+	for t.pos++; t.pos < len(t.data); t.pos++ {
+		switch c := t.data[t.pos]; c {
+		case '"':
+			t.pos++
+			return token.String(), true, nil
+		case '\\':
+			t.pos++
+			if t.pos >= len(t.data) {
+				break
+			}
+			switch escaped := t.data[t.pos]; escaped {
+			case 'n':
+				token.WriteByte('\n')
+			case 't':
+				token.WriteByte('\t')
+			case 'r':
+				token.WriteByte('\r')
+			default:
+				token.WriteByte(escaped)
 			}
+		case '\n':
+			return "", false, fmt.Errorf("line %d: unterminated quoted string", t.line)
+		default:
+			token.WriteByte(c)
 		}
 	}
+	return "", false, fmt.Errorf("line %d: unterminated quoted string", t.line)
+}
 
-	savePassword := func(machine, passwd string) {
-		if machine != "" {
-			if m, ok := usersNetrcFile.machines[machine]; ok {
-				usersNetrcFile.machines[machine] = BasicAuth{User: m.User, Password: passwd}
-			} else {
-				usersNetrcFile.machines[machine] = BasicAuth{Password: passwd}
-			}
+// value returns the token that follows `keyword`.
+func (t *tokenizer) value(keyword string) (string, error) {
+	token, ok, err := t.next(false)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("line %d: missing value after '%s'", t.line, keyword)
+	}
+	return token, nil
+}
+
+// skipMacro skips the definition of a macro, which starts on the line after 'macdef' and ends at
+// the next line that is empty or only contains whitespace.
+func (t *tokenizer) skipMacro() {
+	inFirstLine := true
+	for t.pos < len(t.data) {
+		end := strings.IndexByte(t.data[t.pos:], '\n')
+		if end == -1 {
+			t.pos = len(t.data)
+			return
 		}
+		line := t.data[t.pos : t.pos+end]
+		t.pos += end + 1
+		t.line++
+		if !inFirstLine && strings.TrimSpace(line) == "" {
+			return
+		}
+		inFirstLine = false
 	}
+}
 
-	for _, line := range netrcLines {
-		line = strings.TrimSpace(line)
+// Parse parses the content of a netrc file.
+func Parse(data string) (*Netrc, error) {
+	netrc := &Netrc{machines: map[string]BasicAuth{}}
+	t := tokenizer{data: data, line: 1}
 
-		if strings.HasPrefix(line, "machine") {
-			currentMachine = strings.TrimSpace(strings.TrimPrefix(line, "machine"))
-		} else if strings.HasPrefix(line, "login") {
-			saveUsername(currentMachine, strings.TrimSpace(strings.TrimPrefix(line, "login")))
-		} else if strings.HasPrefix(line, "password") {
-			savePassword(currentMachine, strings.TrimSpace(strings.TrimPrefix(line, "password")))
+	// entry is the machine or default entry that the following tokens belong to.
+	var entry *BasicAuth
+	var machine string
+	save := func() {
+		if entry == nil {
+			return
 		}
+		if machine == "" {
+			netrc.defaultAuth = entry
+		} else if _, exists := netrc.machines[machine]; !exists {
+			// Like other tools, the first entry of a machine wins.
+			netrc.machines[machine] = *entry
+		}
+	}
 
+	for {
+		keyword, ok, err := t.next(true)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		switch keyword {
+		case "machine":
+			save()
+			if machine, err = t.value(keyword); err != nil {
+				return nil, err
+			}
+			entry = &BasicAuth{}
+		case "default":
+			save()
+			machine = ""
+			entry = &BasicAuth{}
+		case "login", "password", "account":
+			value, err := t.value(keyword)
+			if err != nil {
+				return nil, err
+			}
+			if entry == nil {
+				return nil, fmt.Errorf("line %d: '%s' outside of a 'machine' or 'default' entry", t.line, keyword)
+			}
+			if keyword == "login" {
+				entry.User = value
+			} else if keyword == "password" {
+				entry.Password = value
+			}
+		case "macdef":
+			if _, err := t.value(keyword); err != nil {
+				return nil, err
+			}
+			t.skipMacro()
+		default:
+			return nil, fmt.Errorf("line %d: unknown token '%s'", t.line, keyword)
+		}
 	}
+	save()
+	return netrc, nil
 }
 
-func GetAuthForUrl(urlString string) *BasicAuth {
+// AuthForHost returns the credentials for `host`, or nil if there are none.
+func (n *Netrc) AuthForHost(host string) *BasicAuth {
+	if auth, ok := n.machines[host]; ok {
+		return &auth
+	}
+	if n.defaultAuth != nil {
+		auth := *n.defaultAuth
+		return &auth
+	}
+	return nil
+}
+
+func loadUsersNetrc() (*Netrc, error) {
+	usersNetrcOnce.Do(func() {
+		netrcPath, required, err := netrcPath()
+		if err != nil {
+			usersNetrcFile = &Netrc{machines: map[string]BasicAuth{}}
+			return
+		}
+		usersNetrcFile, usersNetrcErr = Load(netrcPath, required)
+	})
+	return usersNetrcFile, usersNetrcErr
+}
+
+// GetAuthForUrl returns the credentials for the host of `urlString` from the user's netrc file
+// ($NETRC or $HOME/.netrc), or nil if there are none.
+func GetAuthForUrl(urlString string) (*BasicAuth, error) {
 	url, err := url.Parse(urlString)
 	if err != nil {
-		log.Warning("Invalid URL %q.\n", urlString)
-		return nil
+		return nil, fmt.Errorf("invalid URL %q", urlString)
 	}
 
-	if auth, ok := usersNetrcFile.machines[url.Hostname()]; ok {
-		return &auth
+	netrc, err := loadUsersNetrc()
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return netrc.AuthForHost(url.Hostname()), nil
 }
@@ -0,0 +1,104 @@
+package netrc
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		host     string
+		expected *BasicAuth
+	}{
+		{"one token per line", "machine example.com\nlogin user\npassword pass\n", "example.com", &BasicAuth{"user", "pass"}},
+		{"single line", "machine example.com login user password pass", "example.com", &BasicAuth{"user", "pass"}},
+		{"several machines on one line", "machine a.com login a password pa machine b.com login b password pb", "b.com", &BasicAuth{"b", "pb"}},
+		{"tabs and indentation", "machine example.com\n\tlogin user\n\tpassword pass", "example.com", &BasicAuth{"user", "pass"}},
+		{"crlf", "machine example.com\r\nlogin user\r\npassword pass\r\n", "example.com", &BasicAuth{"user", "pass"}},
+		{"unknown machine", "machine example.com login user password pass", "example.org", nil},
+		{"default", "machine a.com login a password pa\ndefault login anonymous password guest", "b.com", &BasicAuth{"anonymous", "guest"}},
+		{"machine before default", "machine a.com login a password pa\ndefault login anonymous password guest", "a.com", &BasicAuth{"a", "pa"}},
+		{"account", "machine example.com login user account acct password pass", "example.com", &BasicAuth{"user", "pass"}},
+		{"quoted password", `machine example.com login user password "pass word \"quoted\""`, "example.com", &BasicAuth{"user", `pass word "quoted"`}},
+		{"comment", "# my credentials\nmachine example.com # the server\nlogin user\npassword pass", "example.com", &BasicAuth{"user", "pass"}},
+		{"macdef", "machine a.com login a password pa\nmacdef init\ncd /pub\nmachine b.com\n\nmachine b.com login b password pb", "b.com", &BasicAuth{"b", "pb"}},
+		{"macdef ends at blank line with spaces", "macdef init\ncd /pub\n \t\nmachine b.com login b password pb", "b.com", &BasicAuth{"b", "pb"}},
+		{"macdef with crlf", "macdef init\r\ncd /pub\r\n\r\nmachine b.com login b password pb\r\n", "b.com", &BasicAuth{"b", "pb"}},
+		{"password starting with #", "machine example.com login user password #secret", "example.com", &BasicAuth{"user", "#secret"}},
+		{"comment line between values", "machine example.com\n# the user\nlogin user password pass # trailing", "example.com", &BasicAuth{"user", "pass"}},
+		{"macdef at end", "machine a.com login a password pa\nmacdef init\ncd /pub\n", "a.com", &BasicAuth{"a", "pa"}},
+		{"first entry wins", "machine a.com login first password p1\nmachine a.com login second password p2", "a.com", &BasicAuth{"first", "p1"}},
+		{"login only", "machine example.com login user", "example.com", &BasicAuth{"user", ""}},
+		{"empty", "", "example.com", nil},
+	}
+
+	for _, c := range cases {
+		netrc, err := Parse(c.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+			continue
+		}
+		auth := netrc.AuthForHost(c.host)
+		if (auth == nil) != (c.expected == nil) || (auth != nil && *auth != *c.expected) {
+			t.Errorf("%s: AuthForHost(%q) = %v; expected %v", c.name, c.host, auth, c.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"missing machine name", "machine", "line 1: missing value after 'machine'"},
+		{"missing password", "machine example.com\nlogin user\npassword", "line 3: missing value after 'password'"},
+		{"login outside of entry", "login user password pass", "line 1: 'login' outside of a 'machine' or 'default' entry"},
+		{"unknown token", "machine example.com\nusername user", "line 2: unknown token 'username'"},
+		{"unterminated quote", "machine example.com password \"pass\nlogin user", "line 1: unterminated quoted string"},
+		{"line after macdef", "macdef init\ncd /pub\n\nmachine", "line 4: missing value after 'machine'"},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c.data)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	netrcPath := path.Join(dir, "netrc")
+	if err := os.WriteFile(netrcPath, []byte("machine example.com login user password pass"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	netrc, err := Load(netrcPath, true)
+	if err != nil || netrc.AuthForHost("example.com") == nil {
+		t.Errorf("Load(%q) = %v, %v; expected credentials for example.com", netrcPath, netrc, err)
+	}
+	if _, err := Load(path.Join(dir, "missing"), false); err != nil {
+		t.Errorf("Load failed for a missing optional file: %s", err)
+	}
+	if _, err := Load(path.Join(dir, "missing"), true); err == nil {
+		t.Errorf("Load did not fail for a missing required file")
+	}
+}
+
+func TestNetrcPath(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+	t.Setenv("NETRC", "")
+	if netrcPath, required, err := netrcPath(); netrcPath != "/home/user/.netrc" || required || err != nil {
+		t.Errorf("netrcPath() = %q, %v, %v; expected the file in HOME", netrcPath, required, err)
+	}
+
+	t.Setenv("NETRC", "/etc/netrc")
+	if netrcPath, required, err := netrcPath(); netrcPath != "/etc/netrc" || !required || err != nil {
+		t.Errorf("netrcPath() = %q, %v, %v; expected the file in NETRC", netrcPath, required, err)
+	}
+}
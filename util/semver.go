@@ -0,0 +1,289 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NOTE: As for the dbt version, the integers are limited to at most 6 digits.
+var semVerTagRe = regexp.MustCompile(`^v?(\d{1,6})(\.(\d{1,6}))?(\.(\d{1,6}))?(-([0-9A-Za-z.\-]+))?(\+[0-9A-Za-z.\-]+)?$`)
+
+// SemVer is a semantic version as used in git tags (e.g., `v1.4.2` or `2.0.0-rc1`).
+type SemVer struct {
+	Major, Minor, Patch uint64
+	PreRelease          string
+}
+
+// ParseSemVer parses a (possibly partial) semantic version. The leading `v` is optional. Missing
+// minor and patch components default to zero. The second return value is the number of components
+// that were present in the string and is zero if the string is not a version.
+func ParseSemVer(str string) (SemVer, int) {
+	m := semVerTagRe.FindStringSubmatch(str)
+	if m == nil {
+		return SemVer{}, 0
+	}
+
+	version := SemVer{PreRelease: m[7]}
+	components := 1
+	version.Major, _ = strconv.ParseUint(m[1], 10, 64)
+	if m[3] != "" {
+		version.Minor, _ = strconv.ParseUint(m[3], 10, 64)
+		components++
+	}
+	if m[5] != "" {
+		version.Patch, _ = strconv.ParseUint(m[5], 10, 64)
+		components++
+	}
+	return version, components
+}
+
+func (v SemVer) String() string {
+	if v.PreRelease != "" {
+		return fmt.Sprintf("%d.%d.%d-%s", v.Major, v.Minor, v.Patch, v.PreRelease)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 if `v` is lower than, equal to or greater than `other`.
+// Pre-releases rank below the release itself and are compared as described in SemVer 2.0.
+func (v SemVer) Compare(other SemVer) int {
+	compareUint := func(a, b uint64) int {
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+		return 0
+	}
+
+	if c := compareUint(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	if v.PreRelease == other.PreRelease {
+		return 0
+	}
+	if v.PreRelease == "" {
+		return 1
+	}
+	if other.PreRelease == "" {
+		return -1
+	}
+	return comparePreRelease(v.PreRelease, other.PreRelease)
+}
+
+// comparePreRelease compares the dot-separated identifiers of two pre-releases from left to right.
+// Numeric identifiers are compared numerically and rank below alphanumeric ones, which are compared
+// lexically. If all identifiers are equal, the pre-release with more identifiers is greater.
+func comparePreRelease(a, b string) int {
+	aIdentifiers := strings.Split(a, ".")
+	bIdentifiers := strings.Split(b, ".")
+	for idx := 0; idx < len(aIdentifiers) && idx < len(bIdentifiers); idx++ {
+		aNumber, aErr := strconv.ParseUint(aIdentifiers[idx], 10, 64)
+		bNumber, bErr := strconv.ParseUint(bIdentifiers[idx], 10, 64)
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNumber != bNumber {
+				if aNumber < bNumber {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aIdentifiers[idx], bIdentifiers[idx]); c != 0 {
+				return c
+			}
+		}
+	}
+	if len(aIdentifiers) < len(bIdentifiers) {
+		return -1
+	} else if len(aIdentifiers) > len(bIdentifiers) {
+		return 1
+	}
+	return 0
+}
+
+// bump increments the component at index `components` (1 = major, 2 = minor, 3 = patch) and resets
+// all less significant components.
+func (v SemVer) bump(components int) SemVer {
+	switch components {
+	case 1:
+		return SemVer{Major: v.Major + 1}
+	case 2:
+		return SemVer{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return SemVer{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+}
+
+type versionComparator struct {
+	op      string
+	version SemVer
+}
+
+func (c versionComparator) matches(v SemVer) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// VersionConstraint is a semantic version range such as `^1.4`, `~1.4.2` or `>=2.0.0 <3`.
+// Space-separated comparators must all be satisfied, alternatives can be separated by `||`.
+type VersionConstraint struct {
+	str          string
+	alternatives [][]versionComparator
+}
+
+var constraintOperators = []string{">=", "<=", ">", "<", "=", "^", "~"}
+
+// IsVersionConstraint reports whether `version` is meant as a version constraint rather than
+// as a git reference (branch, tag or hash). Constraints always start with an operator.
+func IsVersionConstraint(version string) bool {
+	version = strings.TrimSpace(version)
+	for _, op := range constraintOperators {
+		if strings.HasPrefix(version, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseVersionConstraint parses a version constraint.
+func ParseVersionConstraint(str string) (VersionConstraint, error) {
+	constraint := VersionConstraint{str: str}
+	for _, alternative := range strings.Split(str, "||") {
+		comparators := []versionComparator{}
+		tokens := strings.Fields(alternative)
+		for idx := 0; idx < len(tokens); idx++ {
+			token := tokens[idx]
+			op := ""
+			for _, candidate := range constraintOperators {
+				if strings.HasPrefix(token, candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return constraint, fmt.Errorf("comparator '%s' in version constraint '%s' has no operator", token, str)
+			}
+			versionStr := strings.TrimPrefix(token, op)
+			// Allow a space between the operator and the version.
+			if versionStr == "" && idx+1 < len(tokens) {
+				idx++
+				versionStr = tokens[idx]
+			}
+			version, components := ParseSemVer(versionStr)
+			if components == 0 {
+				return constraint, fmt.Errorf("'%s' in version constraint '%s' is not a valid version", versionStr, str)
+			}
+			comparators = append(comparators, expandComparator(op, version, components)...)
+		}
+		if len(comparators) == 0 {
+			return constraint, fmt.Errorf("version constraint '%s' has an empty alternative", str)
+		}
+		constraint.alternatives = append(constraint.alternatives, comparators)
+	}
+	return constraint, nil
+}
+
+// expandComparator translates the shorthand operators into plain comparisons. Partial versions
+// cover the whole range they describe, e.g. `<=1.4` is the same as `<1.5.0`.
+func expandComparator(op string, version SemVer, components int) []versionComparator {
+	switch op {
+	case ">=", "<":
+		return []versionComparator{{op, version}}
+	case ">":
+		if components == 3 {
+			return []versionComparator{{">", version}}
+		}
+		return []versionComparator{{">=", version.bump(components)}}
+	case "<=":
+		if components == 3 {
+			return []versionComparator{{"<=", version}}
+		}
+		return []versionComparator{{"<", version.bump(components)}}
+	case "^":
+		upper := version.bump(3)
+		if version.Major > 0 || components == 1 {
+			upper = version.bump(1)
+		} else if version.Minor > 0 || components == 2 {
+			upper = version.bump(2)
+		}
+		return []versionComparator{{">=", version}, {"<", upper}}
+	case "~":
+		if components == 1 {
+			return []versionComparator{{">=", version}, {"<", version.bump(1)}}
+		}
+		return []versionComparator{{">=", version}, {"<", version.bump(2)}}
+	default:
+		if components == 3 {
+			return []versionComparator{{"=", version}}
+		}
+		return []versionComparator{{">=", version}, {"<", version.bump(components)}}
+	}
+}
+
+func (c VersionConstraint) String() string {
+	return c.str
+}
+
+// Matches reports whether `v` satisfies the constraint. Pre-release versions only satisfy
+// alternatives that explicitly mention a pre-release of the same major, minor and patch version.
+func (c VersionConstraint) Matches(v SemVer) bool {
+	for _, alternative := range c.alternatives {
+		matches := true
+		allowsPreRelease := false
+		for _, comparator := range alternative {
+			matches = matches && comparator.matches(v)
+			allowsPreRelease = allowsPreRelease || (comparator.version.PreRelease != "" &&
+				comparator.version.Major == v.Major && comparator.version.Minor == v.Minor && comparator.version.Patch == v.Patch)
+		}
+		if matches && (v.PreRelease == "" || allowsPreRelease) {
+			return true
+		}
+	}
+	return false
+}
+
+// HighestMatchingVersion returns the highest of the given versions (e.g., git tag names) that
+// satisfies all constraints. Strings that are not semantic versions are ignored.
+func HighestMatchingVersion(versions []string, constraints ...VersionConstraint) (string, bool) {
+	best := ""
+	bestVersion := SemVer{}
+	for _, str := range OrderedSlice(versions) {
+		version, components := ParseSemVer(str)
+		if components == 0 {
+			continue
+		}
+		matches := true
+		for _, constraint := range constraints {
+			matches = matches && constraint.Matches(version)
+		}
+		if matches && (best == "" || version.Compare(bestVersion) > 0) {
+			best = str
+			bestVersion = version
+		}
+	}
+	return best, best != ""
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestParseSemVer(t *testing.T) {
+	cases := []struct {
+		str        string
+		version    SemVer
+		components int
+	}{
+		{"v1.4.2", SemVer{1, 4, 2, ""}, 3},
+		{"1.4", SemVer{1, 4, 0, ""}, 2},
+		{"v2", SemVer{2, 0, 0, ""}, 1},
+		{"v2.0.0-rc1", SemVer{2, 0, 0, "rc1"}, 3},
+		{"v2.0.0+build.3", SemVer{2, 0, 0, ""}, 3},
+		{"origin/master", SemVer{}, 0},
+		{"release-1.0", SemVer{}, 0},
+	}
+
+	for _, c := range cases {
+		version, components := ParseSemVer(c.str)
+		if version != c.version || components != c.components {
+			t.Errorf("ParseSemVer(%q) = %v, %d; expected %v, %d", c.str, version, components, c.version, c.components)
+		}
+	}
+}
+
+func TestCompareSemVer(t *testing.T) {
+	// Sorted in ascending order, as in the example of SemVer 2.0 §11.
+	versions := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11",
+		"1.0.0-rc.1", "1.0.0-rc.2", "1.0.0-rc.10", "1.0.0", "1.0.1-rc.1", "1.0.1",
+	}
+
+	for i := range versions {
+		for j := range versions {
+			a, _ := ParseSemVer(versions[i])
+			b, _ := ParseSemVer(versions[j])
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			if c := a.Compare(b); c != expected {
+				t.Errorf("Compare(%q, %q) = %d; expected %d", versions[i], versions[j], c, expected)
+			}
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	cases := []struct {
+		constraint string
+		matching   []string
+		rejected   []string
+	}{
+		{"^1.4", []string{"1.4.0", "v1.9.3"}, []string{"1.3.9", "2.0.0", "v1.5.0-rc1"}},
+		{"^0.4.1", []string{"0.4.1", "0.4.9"}, []string{"0.5.0", "0.4.0"}},
+		{"~1.4.2", []string{"1.4.2", "1.4.7"}, []string{"1.5.0", "1.4.1"}},
+		{">=2.0.0 <3", []string{"2.0.0", "2.99.1"}, []string{"1.9.9", "3.0.0"}},
+		{">= 2.0.0 < 3", []string{"2.0.0"}, []string{"3.0.0"}},
+		{"<=1.4", []string{"1.4.9", "0.1.0"}, []string{"1.5.0"}},
+		{">1.4", []string{"1.5.0"}, []string{"1.4.9"}},
+		{"=1.4", []string{"1.4.0", "1.4.3"}, []string{"1.5.0"}},
+		{"^1.0 || ^3.0", []string{"1.2.0", "3.1.0"}, []string{"2.0.0"}},
+		{">=2.0.0-rc1", []string{"2.0.0-rc2", "2.0.0", "2.1.0"}, []string{"2.0.0-beta", "2.1.0-rc1", "3.0.0-alpha"}},
+		{">=1.0.0", []string{"1.0.0", "1.2.0"}, []string{"1.0.0-rc1", "1.0.1-rc1", "2.0.0-beta.1"}},
+		{">=1.0.0-rc.2 <1.0.0", []string{"1.0.0-rc.2", "1.0.0-rc.10"}, []string{"1.0.0-rc.1", "1.0.0"}},
+	}
+
+	for _, c := range cases {
+		constraint, err := ParseVersionConstraint(c.constraint)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %s", c.constraint, err)
+		}
+		for _, str := range c.matching {
+			version, _ := ParseSemVer(str)
+			if !constraint.Matches(version) {
+				t.Errorf("expected %q to match %q", str, c.constraint)
+			}
+		}
+		for _, str := range c.rejected {
+			version, _ := ParseSemVer(str)
+			if constraint.Matches(version) {
+				t.Errorf("expected %q not to match %q", str, c.constraint)
+			}
+		}
+	}
+}
+
+func TestInvalidVersionConstraint(t *testing.T) {
+	for _, str := range []string{"^", ">=1.x", "^1.0 ||", "1.0"} {
+		if _, err := ParseVersionConstraint(str); err == nil {
+			t.Errorf("expected an error parsing %q", str)
+		}
+	}
+}
+
+func TestIsVersionConstraint(t *testing.T) {
+	for _, str := range []string{"^1.4", "~1", ">=2.0.0 <3", "=1.2.3"} {
+		if !IsVersionConstraint(str) {
+			t.Errorf("expected %q to be a version constraint", str)
+		}
+	}
+	for _, str := range []string{"origin/master", "v1.4.2", "8f2e1a9"} {
+		if IsVersionConstraint(str) {
+			t.Errorf("expected %q not to be a version constraint", str)
+		}
+	}
+}
+
+func TestHighestMatchingVersion(t *testing.T) {
+	tags := []string{"v1.3.0", "v1.4.0", "v1.10.2", "v2.0.0", "latest", "v1.11.0-rc1"}
+	caret, _ := ParseVersionConstraint("^1.4")
+	upper, _ := ParseVersionConstraint("<1.10")
+	major2, _ := ParseVersionConstraint(">=2")
+
+	if best, ok := HighestMatchingVersion(tags, caret); !ok || best != "v1.10.2" {
+		t.Errorf("unexpected highest version %q", best)
+	}
+	if best, ok := HighestMatchingVersion(tags, caret, upper); !ok || best != "v1.4.0" {
+		t.Errorf("unexpected highest version %q", best)
+	}
+	if _, ok := HighestMatchingVersion(tags, caret, major2); ok {
+		t.Error("expected no matching version")
+	}
+}
@@ -26,11 +26,22 @@ import (
 const (
 	ModuleFileName      = "MODULE"
 	ModuleSyntaxVersion = 3
+	// LockFileName is the name of the file storing resolved dependency hashes in lock file mode.
+	LockFileName      = "MODULE.lock"
+	LockSyntaxVersion = 1
+	// LocalFileName is the name of the (git-ignored) file with local workspace settings.
+	LocalFileName = "MODULE.local"
 
 	BuildDirName = "BUILD"
 	// DepsDirName is directory that dependencies are stored in.
 	DepsDirName     = "DEPS"
 	WarningFileName = "WARNING.readme.txt"
+	// SubdirReposDirName is the directory in DEPS/ that holds the repositories of dependencies
+	// that are subdirectories of a repository.
+	SubdirReposDirName = ".repos"
+	// TrashDirName is the directory in DEPS/ that holds the modules deleted by 'dbt sync'. It is not
+	// in BUILD/, so that 'dbt clean' does not delete local work that 'dbt sync' promised to keep.
+	TrashDirName = ".trash"
 )
 
 const (
@@ -146,9 +157,14 @@ func ReadJson(filePath string, v interface{}) {
 }
 
 func ReadYaml(filePath string, v interface{}) {
-	err := yaml.Unmarshal(ReadFile(filePath), v)
+	ParseYaml(filePath, ReadFile(filePath), v)
+}
+
+// ParseYaml unmarshals YAML data that has been read from `source`.
+func ParseYaml(source string, data []byte, v interface{}) {
+	err := yaml.Unmarshal(data, v)
 	if err != nil {
-		log.Fatal("Failed to unmarshal YAML file '%s': %s.\n", filePath, err)
+		log.Fatal("Failed to unmarshal YAML file '%s': %s.\n", source, err)
 	}
 }
 
@@ -240,12 +256,25 @@ func copyDirRecursivelyInner(sourceDir, destDir string, wg *sync.WaitGroup) erro
 	return nil
 }
 
+// hiddenDepsDir returns the DEPS/ directory if `p` is inside of DEPS/.trash/ or DEPS/.repos/. These
+// directories hold modules that are no module of the workspace by themselves.
+func hiddenDepsDir(p string) (string, bool) {
+	for ; p != "/" && p != "."; p = path.Dir(p) {
+		name := path.Base(p)
+		if (name == TrashDirName || name == SubdirReposDirName) && path.Base(path.Dir(p)) == DepsDirName {
+			return path.Dir(p), true
+		}
+	}
+	return "", false
+}
+
 func getModuleRoot(p string) (string, error) {
 	for {
 		moduleFilePath := path.Join(p, ModuleFileName)
 		gitDirPath := path.Join(p, ".git")
 		parentDirName := path.Base(path.Dir(p))
-		if FileExists(moduleFilePath) || parentDirName == DepsDirName || DirExists(gitDirPath) {
+		isDepsEntry := parentDirName == DepsDirName && path.Base(p) != TrashDirName && path.Base(p) != SubdirReposDirName
+		if FileExists(moduleFilePath) || isDepsEntry || DirExists(gitDirPath) {
 			return p, nil
 		}
 		if p == "/" {
@@ -285,14 +314,24 @@ func GetWorkspaceRoot() string {
 
 // internal version of getWorkspaceRoot that returns an error instead of aborting if we run dbt outside of a workspace.
 func getWorkspaceRoot() (string, error) {
+	return getWorkspaceRootForPath(GetWorkingDir())
+}
+
+func getWorkspaceRootForPath(p string) (string, error) {
 	var err error
-	p := GetWorkingDir()
 	for {
 		p, err = getModuleRoot(p)
 		if err != nil {
 			return "", err
 		}
 
+		// Modules in the trash and the repositories of subdirectory dependencies belong to the
+		// workspace that contains the DEPS/ directory.
+		if depsDir, ok := hiddenDepsDir(p); ok {
+			p = path.Dir(depsDir)
+			continue
+		}
+
 		parentDirName := path.Base(path.Dir(p))
 		if parentDirName != DepsDirName {
 			return p, nil
@@ -0,0 +1,44 @@
+package util
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+func TestGetWorkspaceRootForPath(t *testing.T) {
+	root := t.TempDir()
+	workspace := path.Join(root, "workspace")
+	for _, dir := range []string{
+		workspace,
+		path.Join(workspace, DepsDirName, "dep", "src"),
+		path.Join(workspace, DepsDirName, TrashDirName, "20240101-120000", "old", "src"),
+		path.Join(workspace, DepsDirName, SubdirReposDirName, "sub", "lib"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{
+		path.Join(workspace, ModuleFileName),
+		path.Join(workspace, DepsDirName, "dep", ModuleFileName),
+		path.Join(workspace, DepsDirName, TrashDirName, "20240101-120000", "old", ModuleFileName),
+		path.Join(workspace, DepsDirName, SubdirReposDirName, "sub", ModuleFileName),
+	} {
+		if err := os.WriteFile(file, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, dir := range []string{
+		workspace,
+		path.Join(workspace, DepsDirName, "dep", "src"),
+		path.Join(workspace, DepsDirName, TrashDirName),
+		path.Join(workspace, DepsDirName, TrashDirName, "20240101-120000", "old", "src"),
+		path.Join(workspace, DepsDirName, SubdirReposDirName, "sub", "lib"),
+	} {
+		if got, err := getWorkspaceRootForPath(dir); err != nil || got != workspace {
+			t.Errorf("getWorkspaceRootForPath(%q) = %q, %v; expected %q", dir, got, err, workspace)
+		}
+	}
+}